@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// CalculateRequest is the JSON body accepted by /api/calculate
+type CalculateRequest struct {
+	Expression string `json:"expression"`
+	// Steps requests the operations performed, in evaluation order
+	Steps bool `json:"steps"`
+	// Vars binds variables used by the expression, eg. {"x": 5}
+	Vars map[string]float64 `json:"vars,omitempty"`
+}
+
+// CalculateResponse is the JSON body returned by /api/calculate
+type CalculateResponse struct {
+	Valid  bool   `json:"valid"`
+	Result string `json:"result"`
+	Error  string `json:"error"`
+	// Position is the character the error is at, counted from 1, if any
+	Position int      `json:"position,omitempty"`
+	Steps    []string `json:"steps,omitempty"`
+	// Debug is the unrounded result, with ?debug=true or ?debug=full
+	Debug *DebugValue `json:"debug,omitempty"`
+	// Trace is how the result was computed, with ?debug=full
+	Trace *DebugTrace `json:"trace,omitempty"`
+	// Failed is the subexpression that failed to evaluate, with
+	// ?partial=true
+	Failed *FailedSubexpression `json:"failed,omitempty"`
+	// RequestID is the request's X-Request-ID, to find it in the log
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// DebugValue is a float64 result before rounding, to diagnose surprises
+// such as 0.1 + 0.2 being 0.30000000000000004
+type DebugValue struct {
+	// Value is the shortest text that reads back as exactly the result
+	Value string `json:"value"`
+	// Bits is the IEEE 754 bit pattern of the result in hex
+	Bits string `json:"bits"`
+}
+
+// newDebugValue describes the unrounded value of a result
+func newDebugValue(val float64) *DebugValue {
+	return &DebugValue{
+		Value: strconv.FormatFloat(val, 'g', -1, 64),
+		Bits:  fmt.Sprintf("0x%016x", math.Float64bits(val)),
+	}
+}
+
+// FailedSubexpression is the part of an expression whose evaluation failed,
+// with the values of the subexpressions computed beside it
+type FailedSubexpression struct {
+	Subexpression string          `json:"subexpression"`
+	Siblings      []SiblingResult `json:"siblings,omitempty"`
+}
+
+// SiblingResult is a subexpression computed beside the one that failed
+type SiblingResult struct {
+	Expression string `json:"expression"`
+	Value      string `json:"value"`
+}
+
+// newFailedSubexpression describes the subexpression err reports as
+// failing, or returns nil if it doesn't report one
+func newFailedSubexpression(err error, opts calc.Options) *FailedSubexpression {
+	var evalErr *calc.EvalError
+	if !errors.As(err, &evalErr) {
+		return nil
+	}
+
+	failed := &FailedSubexpression{Subexpression: evalErr.Subexpression}
+	for _, sibling := range evalErr.Siblings {
+		failed.Siblings = append(failed.Siblings, SiblingResult{Expression: sibling.Expression, Value: calc.FormatFloat(sibling.Value, opts.Precision, opts.Rounding)})
+	}
+	return failed
+}
+
+// DebugTrace bundles the stages of a calculation, to see at once how an
+// expression was normalized, tokenized, parsed and evaluated. For input of
+// several statements it describes the last, whose value is the result.
+type DebugTrace struct {
+	Normalized string     `json:"normalized"`
+	Tokens     []string   `json:"tokens"`
+	Tree       *calc.Node `json:"tree"`
+	// Parenthesized is the tree written out with every operation in
+	// parentheses, eg. (1 + (2 * 3))
+	Parenthesized string   `json:"parenthesized"`
+	Steps         []string `json:"steps"`
+	Result        string   `json:"result"`
+}
+
+// newDebugTrace describes the calculation of a successful result
+func newDebugTrace(Expr string, opts calc.Options, result calc.Result) (*DebugTrace, error) {
+	statements := calc.Statements(Expr)
+	statement := statements[len(statements)-1]
+
+	// The last statement may use the variables and ans of the ones before
+	if len(statements) > 1 {
+		vars := maps.Clone(opts.Vars)
+		if vars == nil {
+			vars = make(map[string]float64)
+		}
+		maps.Copy(vars, result.Vars)
+		vars[calc.Ans] = 0
+		opts.Vars = vars
+	}
+
+	normalized, err := calc.Preprocess(statement, calc.PreprocessorsFor(opts))
+	if err != nil {
+		return nil, err
+	}
+	tokens, tree, err := parseTree(statement, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DebugTrace{
+		Normalized:    normalized,
+		Tokens:        tokens,
+		Tree:          tree,
+		Parenthesized: tree.String(),
+		Steps:         result.Steps,
+		Result:        result.Text,
+	}, nil
+}
+
+// apiCalculateHandler evaluates a JSON encoded expression. The response is
+// JSON, or just the result as text with ?format=plain or Accept: text/plain.
+// With ?debug=true the JSON also has the unrounded value, and with
+// ?debug=full the trace of how it was computed too. With ?partial=true an
+// evaluation error names the subexpression that failed.
+func (c *Calculator) apiCalculateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeCalculateResponse(w, r, http.StatusMethodNotAllowed, CalculateResponse{Error: "method not allowed, use POST"})
+		return
+	}
+
+	var req CalculateRequest
+	if status, err := decodeJSON(w, r, &req); err != nil {
+		writeCalculateResponse(w, r, status, CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	debug := r.URL.Query().Get("debug")
+	opts := baseOptions()
+	opts.Steps = req.Steps || debug == "full"
+	opts.Partial = r.URL.Query().Get("partial") == "true"
+
+	if err := parseSettings(&opts, r.URL.Query()); err != nil {
+		writeCalculateResponse(w, r, http.StatusBadRequest, CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	// Check the names in order, so the error reported is always the same
+	names := make([]string, 0, len(req.Vars))
+	for name := range req.Vars {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := calc.CheckVariableName(name, opts); err != nil {
+			writeCalculateResponse(w, r, http.StatusBadRequest, CalculateResponse{Error: err.Error()})
+			return
+		}
+	}
+	opts.Vars = req.Vars
+
+	result, err := c.safeCalculate(r.Context(), req.Expression, opts)
+	if err != nil {
+		writeCalculateResponse(w, r, http.StatusOK, CalculateResponse{Error: err.Error(), Position: calc.ErrorPosition(err), Failed: newFailedSubexpression(err, opts)})
+		return
+	}
+
+	resp := CalculateResponse{Valid: true, Result: result.Text}
+	if req.Steps {
+		resp.Steps = result.Steps
+	}
+	if debug == "true" || debug == "full" {
+		resp.Debug = newDebugValue(result.Value)
+	}
+	if debug == "full" {
+		if resp.Trace, err = newDebugTrace(req.Expression, opts, result); err != nil {
+			writeCalculateResponse(w, r, http.StatusInternalServerError, CalculateResponse{Error: err.Error()})
+			return
+		}
+	}
+	writeCalculateResponse(w, r, http.StatusOK, resp)
+}
+
+// wantsPlainText reports whether the client asked for a text/plain response
+func wantsPlainText(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "plain" || strings.Contains(r.Header.Get("Accept"), "text/plain")
+}
+
+// writeCalculateResponse writes resp as JSON, or as its result or error
+// text if the client asked for plain text. A failed calculation is then
+// reported with 422 rather than 200, so scripts can detect it with curl -f.
+func writeCalculateResponse(w http.ResponseWriter, r *http.Request, status int, resp CalculateResponse) {
+	resp.RequestID = requestID(r.Context())
+	if !wantsPlainText(r) {
+		writeJSON(w, status, resp)
+		return
+	}
+
+	text := resp.Result
+	if !resp.Valid {
+		text = resp.Error
+		if status == http.StatusOK {
+			status = http.StatusUnprocessableEntity
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	fmt.Fprintln(w, text)
+}
+
+// maxBatchSize is the most expressions accepted by one /api/batch request
+const maxBatchSize = 1000
+
+// BatchRequest is the JSON body accepted by /api/batch
+type BatchRequest struct {
+	Expressions []string `json:"expressions"`
+}
+
+// BatchResult is the outcome of one expression from /api/batch
+type BatchResult struct {
+	Expression string `json:"expression"`
+	CalculateResponse
+}
+
+// maxIdempotencyKeyLength is the longest Idempotency-Key header accepted
+const maxIdempotencyKeyLength = 255
+
+// apiBatchHandler evaluates a list of expressions independently, returning
+// their results in the same order. Comments are stripped as in CLI scripts,
+// and expressions that are only a comment are skipped. A request with an
+// Idempotency-Key header that repeats an earlier one is answered with the
+// earlier response.
+func (c *Calculator) apiBatchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, CalculateResponse{Error: "method not allowed, use POST"})
+		return
+	}
+
+	var req BatchRequest
+	if status, err := decodeJSON(w, r, &req); err != nil {
+		writeJSON(w, status, CalculateResponse{Error: err.Error()})
+		return
+	}
+	if len(req.Expressions) > maxBatchSize {
+		writeJSON(w, http.StatusBadRequest, CalculateResponse{Error: fmt.Sprintf("too many expressions, the limit is %d", maxBatchSize)})
+		return
+	}
+
+	opts := baseOptions()
+	if err := parseSettings(&opts, r.URL.Query()); err != nil {
+		writeJSON(w, http.StatusBadRequest, CalculateResponse{Error: err.Error()})
+		return
+	}
+
+	// The settings are part of the request a key stands for, which is only
+	// kept as a hash
+	key := r.Header.Get("Idempotency-Key")
+	request := RequestHash(sha256.Sum256(fmt.Appendf(nil, "%q\x00%s", req.Expressions, r.URL.RawQuery)))
+	if len(key) > maxIdempotencyKeyLength {
+		writeJSON(w, http.StatusBadRequest, CalculateResponse{Error: fmt.Sprintf("Idempotency-Key is too long, the limit is %d characters", maxIdempotencyKeyLength)})
+		return
+	}
+	if key != "" {
+		body, ok, conflict := c.idempotency.Get(key, request)
+		if conflict {
+			writeJSON(w, http.StatusUnprocessableEntity, CalculateResponse{Error: "Idempotency-Key was already used for a different request"})
+			return
+		}
+		if ok {
+			w.Header().Set("Idempotent-Replayed", "true")
+			writeJSONBody(w, http.StatusOK, body)
+			return
+		}
+	}
+
+	results := make([]BatchResult, 0, len(req.Expressions))
+	for _, expr := range req.Expressions {
+		stripped := stripComment(expr)
+		if stripped == "" && strings.Contains(expr, "#") {
+			continue
+		}
+
+		entry := BatchResult{Expression: expr}
+		result, err := c.safeCalculate(r.Context(), stripped, opts)
+		if err != nil {
+			entry.Error = err.Error()
+		} else {
+			entry.Valid = true
+			entry.Result = result.Text
+		}
+		results = append(results, entry)
+	}
+
+	body, err := encodeJSON(results)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, CalculateResponse{Error: err.Error()})
+		return
+	}
+	if key != "" {
+		c.idempotency.Put(key, request, body)
+	}
+	writeJSONBody(w, http.StatusOK, body)
+}
+
+// ValidateResponse is the JSON body returned by /api/validate
+type ValidateResponse struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+	// Position is the character the error is at, counted from 1, if any
+	Position int `json:"position,omitempty"`
+}
+
+// apiValidateHandler checks the syntax of the expr parameter, or of a JSON
+// encoded expression, without evaluating it. It is cheap enough to call on
+// every keystroke.
+func apiValidateHandler(w http.ResponseWriter, r *http.Request) {
+	var Expr string
+	switch r.Method {
+	case http.MethodGet:
+		Expr = r.URL.Query().Get("expr")
+	case http.MethodPost:
+		var req CalculateRequest
+		if status, err := decodeJSON(w, r, &req); err != nil {
+			writeJSON(w, status, ValidateResponse{Error: err.Error()})
+			return
+		}
+		Expr = req.Expression
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, ValidateResponse{Error: "method not allowed, use GET or POST"})
+		return
+	}
+
+	opts := baseOptions()
+	if err := parseSettings(&opts, r.URL.Query()); err != nil {
+		writeJSON(w, http.StatusBadRequest, ValidateResponse{Error: err.Error()})
+		return
+	}
+
+	if err := checkLength(Expr); err != nil {
+		writeJSON(w, http.StatusOK, ValidateResponse{Error: err.Error()})
+		return
+	}
+	if err := calc.Check(Expr, opts); err != nil {
+		writeJSON(w, http.StatusOK, ValidateResponse{Error: err.Error(), Position: calc.ErrorPosition(err)})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ValidateResponse{Valid: true})
+}
+
+// maxBodyBytes bounds the JSON request bodies read by the API, which is
+// ample for a full batch of expressions at the default -max-length. Larger
+// bodies are rejected before they are decoded.
+const maxBodyBytes = 8 << 20
+
+// decodeJSON decodes the request body into v, returning the status code to
+// respond with if it is too large or malformed
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) (int, error) {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes)).Decode(v)
+
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge, fmt.Errorf("request body too large, the limit is %d bytes", maxBodyBytes)
+	case err != nil:
+		return http.StatusBadRequest, errors.New("malformed JSON body: " + err.Error())
+	}
+	return http.StatusOK, nil
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// encodeJSON returns v encoded as writeJSON writes it
+func encodeJSON(v any) ([]byte, error) {
+	var b bytes.Buffer
+	err := json.NewEncoder(&b).Encode(v)
+	return b.Bytes(), err
+}
+
+// writeJSONBody writes a response already encoded by encodeJSON
+func writeJSONBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
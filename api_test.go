@@ -0,0 +1,122 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAPICalculateDebugFull(t *testing.T) {
+	tests := []struct {
+		expr          string
+		normalized    string
+		tokens        []string
+		parenthesized string
+		result        string
+	}{
+		{expr: "1 + 2 * 3", normalized: "1+2*3", tokens: []string{"1", "+", "2", "*", "3"}, parenthesized: "(1 + (2 * 3))", result: "7"},
+		{expr: "-2^2", normalized: "-2^2", tokens: []string{"-", "2", "^", "2"}, parenthesized: "(-(2 ^ 2))", result: "-4"},
+		{expr: "x = 4; sqrt(x) + ans", normalized: "sqrt(x)+ans", tokens: []string{"sqrt", "(", "x", ")", "+", "ans"}, parenthesized: "(sqrt(x) + ans)", result: "6"},
+	}
+
+	c := newTestCalculator()
+	for _, tc := range tests {
+		w := postJSON(t, c.apiCalculateHandler, "/api/calculate?debug=full", CalculateRequest{Expression: tc.expr})
+		var resp CalculateResponse
+		decodeResponse(t, w, &resp)
+
+		if !resp.Valid || resp.Result != tc.result {
+			t.Errorf("%s: got %q valid %v (%s), want %q", tc.expr, resp.Result, resp.Valid, resp.Error, tc.result)
+			continue
+		}
+		if resp.Debug == nil || resp.Debug.Bits == "" {
+			t.Errorf("%s: no debug value", tc.expr)
+		}
+		trace := resp.Trace
+		if trace == nil {
+			t.Errorf("%s: no trace", tc.expr)
+			continue
+		}
+		if trace.Normalized != tc.normalized {
+			t.Errorf("%s: normalized %q, want %q", tc.expr, trace.Normalized, tc.normalized)
+		}
+		if !slices.Equal(trace.Tokens, tc.tokens) {
+			t.Errorf("%s: tokens %q, want %q", tc.expr, trace.Tokens, tc.tokens)
+		}
+		if trace.Tree == nil {
+			t.Errorf("%s: no tree", tc.expr)
+		}
+		if trace.Parenthesized != tc.parenthesized {
+			t.Errorf("%s: parenthesized %q, want %q", tc.expr, trace.Parenthesized, tc.parenthesized)
+		}
+		if len(trace.Steps) == 0 {
+			t.Errorf("%s: no steps", tc.expr)
+		}
+		if trace.Result != tc.result {
+			t.Errorf("%s: trace result %q, want %q", tc.expr, trace.Result, tc.result)
+		}
+		if resp.Steps != nil {
+			t.Errorf("%s: steps %q outside the trace, which weren't requested", tc.expr, resp.Steps)
+		}
+	}
+}
+
+func TestAPICalculateDebugSections(t *testing.T) {
+	c := newTestCalculator()
+	w := postJSON(t, c.apiCalculateHandler, "/api/calculate?debug=full", CalculateRequest{Expression: "2 * (3 + 4)"})
+	for _, section := range []string{`"normalized"`, `"tokens"`, `"tree"`, `"parenthesized"`, `"steps"`, `"result"`, `"bits"`} {
+		if !strings.Contains(w.Body.String(), section) {
+			t.Errorf("response %s has no %s section", w.Body, section)
+		}
+	}
+
+	w = postJSON(t, c.apiCalculateHandler, "/api/calculate?debug=true", CalculateRequest{Expression: "2 * (3 + 4)"})
+	if strings.Contains(w.Body.String(), `"trace"`) {
+		t.Errorf("debug=true response %s has a trace", w.Body)
+	}
+}
+
+func TestAPICalculatePartial(t *testing.T) {
+	c := newTestCalculator()
+
+	w := postJSON(t, c.apiCalculateHandler, "/api/calculate?partial=true", CalculateRequest{Expression: "1 + (2/0)"})
+	var resp CalculateResponse
+	decodeResponse(t, w, &resp)
+	if resp.Valid || resp.Error != "division by zero in (2 / 0)" {
+		t.Errorf("got valid %v, error %q", resp.Valid, resp.Error)
+	}
+	want := FailedSubexpression{Subexpression: "(2 / 0)", Siblings: []SiblingResult{{Expression: "1", Value: "1"}}}
+	if resp.Failed == nil || resp.Failed.Subexpression != want.Subexpression || !slices.Equal(resp.Failed.Siblings, want.Siblings) {
+		t.Errorf("failed %+v, want %+v", resp.Failed, want)
+	}
+
+	w = postJSON(t, c.apiCalculateHandler, "/api/calculate", CalculateRequest{Expression: "1 + (2/0)"})
+	resp = CalculateResponse{}
+	decodeResponse(t, w, &resp)
+	if resp.Failed != nil || resp.Error != "division by zero" {
+		t.Errorf("without ?partial=true: failed %+v, error %q", resp.Failed, resp.Error)
+	}
+}
+
+func TestAPIErrorPosition(t *testing.T) {
+	tests := []struct {
+		expr     string
+		err      string
+		position int
+	}{
+		{expr: "1 + #", err: "unexpected character '#' at position 5", position: 5},
+		{expr: "1 + (2", err: "unbalanced parentheses at position 5", position: 5},
+		{expr: "2 +* 3", err: "invalid expression at position 4", position: 4},
+		{expr: "1/0", err: "division by zero"},
+	}
+
+	c := newTestCalculator()
+	for _, tc := range tests {
+		w := postJSON(t, c.apiCalculateHandler, "/api/calculate", CalculateRequest{Expression: tc.expr})
+		var resp CalculateResponse
+		decodeResponse(t, w, &resp)
+		if resp.Valid || resp.Error != tc.err || resp.Position != tc.position {
+			t.Errorf("%s: error %q at %d, want %q at %d", tc.expr, resp.Error, resp.Position, tc.err, tc.position)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// ASTResponse is the JSON body returned by /api/ast
+type ASTResponse struct {
+	Tokens []string   `json:"tokens"`
+	Tree   *calc.Node `json:"tree"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// apiASTHandler returns the tokens and parse tree of the expr parameter,
+// for diagnosing how an expression is parsed
+func apiASTHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, ASTResponse{Error: "method not allowed, use GET"})
+		return
+	}
+
+	opts := baseOptions()
+	if err := parseSettings(&opts, r.URL.Query()); err != nil {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Error: err.Error()})
+		return
+	}
+
+	Expr := r.URL.Query().Get("expr")
+	if err := checkLength(Expr); err != nil {
+		writeJSON(w, http.StatusBadRequest, ASTResponse{Error: err.Error()})
+		return
+	}
+
+	tokens, tree, err := parseTree(Expr, opts)
+	if err != nil {
+		writeJSON(w, http.StatusOK, ASTResponse{Tokens: tokens, Error: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ASTResponse{Tokens: tokens, Tree: tree})
+}
+
+// parseTree validates the expression, or the value of an assignment, and
+// returns its tokens and tree. If the tree can't be built the tokens are
+// still returned when tokenizing succeeded.
+func parseTree(Expr string, opts calc.Options) ([]string, *calc.Node, error) {
+	tokens, err := calc.Tokens(Expr, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := calc.Check(Expr, opts); err != nil {
+		return tokens, nil, err
+	}
+
+	tree := calc.BuildTree(tokens)
+	if tree == nil {
+		return tokens, nil, errors.New("could not build a tree from the tokens")
+	}
+	return tokens, tree, nil
+}
+
+// formatTree renders the tree as indented text, one node per line
+func formatTree(node *calc.Node) string {
+	var b strings.Builder
+	writeTree(&b, node, 0)
+	return b.String()
+}
+
+func writeTree(b *strings.Builder, node *calc.Node, depth int) {
+	if node == nil {
+		return
+	}
+
+	b.WriteString(strings.Repeat("  ", depth))
+	b.WriteString(node.Value)
+	b.WriteString("\n")
+
+	for _, arg := range node.Args {
+		writeTree(b, arg, depth+1)
+	}
+	writeTree(b, node.Left, depth+1)
+	writeTree(b, node.Right, depth+1)
+}
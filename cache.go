@@ -0,0 +1,101 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// ResultCache is a least recently used cache of calculation outcomes, safe
+// for concurrent use by request handlers
+type ResultCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// cachedResult is one remembered calculation
+type cachedResult struct {
+	key    string
+	valid  bool
+	result calc.Result
+}
+
+// NewResultCache returns an empty cache holding up to size results. A size
+// of 0 disables caching.
+func NewResultCache(size int) *ResultCache {
+	return &ResultCache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// cacheKey identifies a calculation by its normalized expression, every
+// setting the result depends on and the values of the variables it names.
+// Other variables are left out, so the key stays short however many are
+// bound and assigning one doesn't change the key of expressions not using it.
+func cacheKey(Expr string, opts calc.Options) string {
+	if normalized, err := calc.Preprocess(Expr, calc.PreprocessorsFor(opts)); err == nil {
+		Expr = normalized
+	}
+
+	var key strings.Builder
+	vars := opts.Vars
+	opts.Vars = nil
+	fmt.Fprintf(&key, "%s\x00%+v", Expr, opts)
+
+	// Names are runs of letters, and those that aren't bound are part of
+	// the key too, as binding them later changes the result
+	names := strings.FieldsFunc(Expr, func(ch rune) bool { return !unicode.IsLetter(ch) })
+	slices.Sort(names)
+	for _, name := range slices.Compact(names) {
+		if val, bound := vars[name]; bound {
+			fmt.Fprintf(&key, "\x00%s=%s", name, strconv.FormatFloat(val, 'g', -1, 64))
+		} else {
+			fmt.Fprintf(&key, "\x00%s", name)
+		}
+	}
+	return key.String()
+}
+
+// Get returns the remembered outcome for key, marking it recently used
+func (c *ResultCache) Get(key string) (bool, calc.Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return false, calc.Result{}, false
+	}
+	c.order.MoveToFront(elem)
+
+	entry := elem.Value.(*cachedResult)
+	return entry.valid, entry.result, true
+}
+
+// Put remembers an outcome, evicting the least recently used one when full
+func (c *ResultCache) Put(key string, valid bool, result calc.Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.size <= 0 {
+		return
+	}
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value = &cachedResult{key: key, valid: valid, result: result}
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	if c.order.Len() >= c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResult).key)
+	}
+	c.entries[key] = c.order.PushFront(&cachedResult{key: key, valid: valid, result: result})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+func TestCacheKey(t *testing.T) {
+	withVars := func(vars map[string]float64) calc.Options {
+		opts := calc.DefaultOptions()
+		opts.Vars = vars
+		return opts
+	}
+	degrees := calc.DefaultOptions()
+	degrees.Angle = calc.Degrees
+
+	tests := []struct {
+		name   string
+		a, b   string
+		aOpts  calc.Options
+		bOpts  calc.Options
+		shared bool
+	}{
+		{name: "spacing", a: "1 + 2", b: "1+2", aOpts: calc.DefaultOptions(), bOpts: calc.DefaultOptions(), shared: true},
+		{name: "unused variable", a: "x + 1", b: "x + 1", aOpts: withVars(map[string]float64{"x": 1}), bOpts: withVars(map[string]float64{"x": 1, "y": 2}), shared: true},
+		{name: "used variable", a: "x + 1", b: "x + 1", aOpts: withVars(map[string]float64{"x": 1}), bOpts: withVars(map[string]float64{"x": 2})},
+		{name: "variable bound later", a: "y + 1", b: "y + 1", aOpts: withVars(nil), bOpts: withVars(map[string]float64{"y": 2})},
+		{name: "ans", a: "ans * 2", b: "ans * 2", aOpts: withVars(map[string]float64{"ans": 1}), bOpts: withVars(map[string]float64{"ans": 3})},
+		{name: "settings", a: "sin(30)", b: "sin(30)", aOpts: calc.DefaultOptions(), bOpts: degrees},
+		{name: "expression", a: "1 + 2", b: "1 + 3", aOpts: calc.DefaultOptions(), bOpts: calc.DefaultOptions()},
+	}
+
+	for _, tc := range tests {
+		a, b := cacheKey(tc.a, tc.aOpts), cacheKey(tc.b, tc.bOpts)
+		if (a == b) != tc.shared {
+			t.Errorf("%s: keys %q and %q, want shared %v", tc.name, a, b, tc.shared)
+		}
+	}
+}
+
+func TestResultCacheEviction(t *testing.T) {
+	c := NewResultCache(2)
+	c.Put("a", true, calc.Result{Text: "1"})
+	c.Put("b", true, calc.Result{Text: "2"})
+	c.Get("a")
+	c.Put("c", true, calc.Result{Text: "3"})
+
+	if _, _, cached := c.Get("b"); cached {
+		t.Error("the least recently used result was kept")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, _, cached := c.Get(key); !cached {
+			t.Errorf("result %s was evicted", key)
+		}
+	}
+
+	disabled := NewResultCache(0)
+	disabled.Put("a", true, calc.Result{})
+	if _, _, cached := disabled.Get("a"); cached {
+		t.Error("a cache of size 0 kept a result")
+	}
+}
+
+// benchmarkCalculation repeats an expression with many variables bound, as
+// after a long session of assignments
+func benchmarkCalculation(b *testing.B, cacheSize int) {
+	c := NewCalculator(NewHistory(historySize), cacheSize)
+	opts := baseOptions()
+	opts.Vars = make(map[string]float64)
+	for i := 0; i < 100; i++ {
+		opts.Vars[fmt.Sprintf("v%c%c", 'a'+i/26, 'a'+i%26)] = float64(i)
+	}
+	opts.Vars["x"] = 3
+
+	const expr = "sqrt(x^2 + 16) * (sin(x) + cos(x)) / (1 + x!) - 2^(x/3)"
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if valid, result := c.performArithmeticCalculation(ctx, expr, opts); !valid {
+			b.Fatal(result.Text)
+		}
+	}
+}
+
+func BenchmarkCalculateCached(b *testing.B) {
+	benchmarkCalculation(b, 1024)
+}
+
+func BenchmarkCalculateUncached(b *testing.B) {
+	benchmarkCalculation(b, 0)
+}
@@ -0,0 +1,773 @@
+// Package calc tokenizes, parses and evaluates arithmetic expressions.
+//
+// Eval is the simplest entry point, evaluating an expression with the
+// default options. The Result holds the value and its formatted text:
+//
+//	result, err := calc.Eval("1 + 2 * 3") // result.Value is 7
+//
+// EvalWithOptions evaluates with the given Options, which select the
+// precision and rounding, the angle unit and the decimal, exact or complex
+// modes:
+//
+//	opts := calc.DefaultOptions()
+//	opts.Exact = true
+//	result, err := calc.EvalWithOptions("1/3 + 1/6", opts) // result.Text is "1/2"
+//
+// Evaluate returns just the unrounded float64 value, and CalculateContext
+// gives up once a context is done.
+//
+// Parse and EvalTree evaluate an expression many times with different
+// variable values. Errors in the expression's syntax are reported with
+// their position as an *ExprError.
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultPrecision is the number of decimal places results are rounded to
+	DefaultPrecision = 4
+	// MaxPrecision is the largest supported number of decimal places
+	MaxPrecision = 15
+	// MaxSigFigs is the largest supported number of significant figures
+	MaxSigFigs = 15
+	// MaxExactDigits is the most decimal places an exact result is shown with
+	MaxExactDigits = 100
+	// DefaultScale is the number of fractional digits kept in decimal mode
+	DefaultScale = 20
+	// DefaultMaxDepth is the deepest parenthesis nesting accepted by default
+	DefaultMaxDepth = 256
+)
+
+// Options selects optional evaluation modes
+type Options struct {
+	// Precision is the number of decimal places float64 results are
+	// rounded to, between 0 and MaxPrecision
+	Precision int
+	// Rounding selects how float64 results are rounded to Precision
+	Rounding RoundingMode
+	// SigFigs rounds float64 results to that many significant figures
+	// instead of Precision decimal places when positive, up to MaxSigFigs
+	SigFigs int
+	// Angle is the unit trigonometric functions work in
+	Angle AngleMode
+	// Physics enables the named constants in physicsConstants
+	Physics bool
+	// Decimal evaluates in base-10 fixed-point arithmetic with Scale
+	// fractional digits instead of float64
+	Decimal bool
+	Scale   int
+	// Exact evaluates over math/big rationals. The result is a reduced
+	// fraction, or a decimal with ExactDigits digits when that is positive.
+	Exact       bool
+	ExactDigits int
+	// Fractions evaluates expressions of only integers and + - * / over
+	// the rationals too, so 2/4 is 1/2, and anything else as usual
+	Fractions bool
+	// MaxDepth is the deepest parenthesis nesting accepted, or
+	// DefaultMaxDepth if not positive
+	MaxDepth int
+	// Vars binds names such as ans to values the expression may reference
+	Vars map[string]float64
+	// LenientSeparators ignores a single trailing ';' or ',', at the end of
+	// the input or of an argument list as in max(1, 2,), instead of
+	// rejecting the expression
+	LenientSeparators bool
+	// DecimalComma reads ',' as the decimal point and '.' as a digit group
+	// separator, as in 1.234,5. Function arguments are separated by ';'.
+	DecimalComma bool
+	// Complex evaluates over the complex numbers, with i as the imaginary
+	// unit. Result.Value is the real part.
+	Complex bool
+	// Percent reads a '%' that isn't followed by a number, name or '(' as
+	// a postfix percentage, so 50% is 0.5 and 200 + 10% is 220
+	Percent bool
+	// Steps records every operation of a float64 evaluation in
+	// Result.Steps, innermost first
+	Steps bool
+	// Partial reports a float64 evaluation error as an *EvalError naming the
+	// subexpression that failed, such as (2 / 0) in 1 + (2/0), with the
+	// values of the subexpressions beside it
+	Partial bool
+	// Aliases maps extra characters to the operator each is read as, eg.
+	// ':' to '/'. Check them with CheckAliases.
+	Aliases map[rune]rune
+}
+
+// RoundingMode selects how a result is rounded to its precision
+type RoundingMode string
+
+const (
+	// RoundHalfAwayFromZero rounds to the nearest value, with halves rounded
+	// away from zero. It is the default.
+	RoundHalfAwayFromZero RoundingMode = "round"
+	// RoundFloor rounds toward negative infinity
+	RoundFloor RoundingMode = "floor"
+	// RoundCeil rounds toward positive infinity
+	RoundCeil RoundingMode = "ceil"
+	// RoundTrunc rounds toward zero
+	RoundTrunc RoundingMode = "trunc"
+)
+
+// ParseRoundingMode parses a rounding mode name, where blank means the
+// default
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	switch mode := RoundingMode(strings.ToLower(name)); mode {
+	case "":
+		return RoundHalfAwayFromZero, nil
+	case RoundHalfAwayFromZero, RoundFloor, RoundCeil, RoundTrunc:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown rounding mode %q, expected round, floor, ceil or trunc", name)
+	}
+}
+
+// AngleMode selects the unit of angles taken and returned by trigonometric
+// functions
+type AngleMode string
+
+const (
+	// Radians is the default angle unit, matching package math
+	Radians AngleMode = "rad"
+	// Degrees measures angles in degrees
+	Degrees AngleMode = "deg"
+)
+
+// ParseAngleMode parses an angle unit name, where blank means radians
+func ParseAngleMode(name string) (AngleMode, error) {
+	switch mode := AngleMode(strings.ToLower(name)); mode {
+	case "":
+		return Radians, nil
+	case Radians, Degrees:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown angle mode %q, expected rad or deg", name)
+	}
+}
+
+// constants maps the built-in constant names to their values
+var constants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// physicsConstants maps the names recognized in physics mode to their SI
+// values. They are opt-in so they don't clash with single-letter variables.
+var physicsConstants = map[string]float64{
+	"c": 299792458,      // speed of light in vacuum, m/s (exact)
+	"g": 9.80665,        // standard acceleration of gravity, m/s^2 (exact)
+	"h": 6.62607015e-34, // Planck constant, J*s (exact)
+	"G": 6.67430e-11,    // Newtonian constant of gravitation, m^3/(kg*s^2)
+	"k": 1.380649e-23,   // Boltzmann constant, J/K (exact)
+}
+
+// DefaultOptions returns the options used by Evaluate, as a starting point
+// for Calculate
+func DefaultOptions() Options {
+	return Options{Precision: DefaultPrecision, Rounding: RoundHalfAwayFromZero, Angle: Radians, Scale: DefaultScale, MaxDepth: DefaultMaxDepth}
+}
+
+// ErrInvalidExpression is reported for input that fails validation
+var ErrInvalidExpression = errors.New("invalid expression")
+
+// ErrEmptyExpression is reported for input that is blank once normalized
+var ErrEmptyExpression = errors.New("expression is empty")
+
+// Ans names the previous result, bound through Options.Vars
+const Ans = "ans"
+
+// Memory names the memory register, bound through Options.Vars
+const Memory = "MR"
+
+// ErrTimeout is reported when a calculation runs past its context's deadline
+var ErrTimeout = errors.New("calculation timed out")
+
+// checkContext returns ErrTimeout once ctx is past its deadline, or the
+// context's error if it was cancelled
+func checkContext(ctx context.Context) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return ctx.Err()
+}
+
+// ErrNoPreviousResult is reported when ans is used before it is bound
+var ErrNoPreviousResult = errors.New("no previous result for ans")
+
+// Errors reported for float64 results that aren't finite numbers
+var (
+	ErrOverflow = errors.New("result overflowed")
+	ErrNaN      = errors.New("result is not a number")
+)
+
+// CheckFinite returns ErrOverflow for an infinite result and ErrNaN for NaN
+func CheckFinite(val float64) error {
+	switch {
+	case math.IsInf(val, 0):
+		return ErrOverflow
+	case math.IsNaN(val):
+		return ErrNaN
+	}
+	return nil
+}
+
+// Evaluate evaluates the expression with the default options and returns
+// the unrounded result
+func Evaluate(expr string) (float64, error) {
+	tree, err := parse(expr, DefaultOptions())
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := EvalTree(tree, nil)
+	if err != nil {
+		return 0, err
+	}
+	if err := CheckFinite(result); err != nil {
+		return 0, err
+	}
+	return result, nil
+}
+
+// Result is a calculated value along with its formatted text
+type Result struct {
+	// Text is the result formatted for the selected mode and precision
+	Text string
+	// Value is the unrounded result, approximated as a float64 in the
+	// decimal and exact modes
+	Value float64
+	// Fraction is the exact result as a reduced fraction, in exact mode
+	Fraction string
+	// Steps are the operations performed, such as 2 * 3 = 6, when
+	// Options.Steps is set
+	Steps []string
+	// Assigned is the variable an assignment such as x = 5 binds Value to,
+	// for the caller to store
+	Assigned string
+	// Vars are the variables assigned by every statement of an input such
+	// as x = 5; y = 3; x * y, for the caller to store
+	Vars map[string]float64
+}
+
+// Eval evaluates the expression with the default options, returning the
+// value and its text rounded to DefaultPrecision places
+func Eval(Expr string) (Result, error) {
+	return CalculateContext(context.Background(), Expr, DefaultOptions())
+}
+
+// EvalWithOptions evaluates the expression with the given options, such as
+// the precision, the angle unit or exact mode. Start from DefaultOptions.
+func EvalWithOptions(Expr string, opts Options) (Result, error) {
+	return CalculateContext(context.Background(), Expr, opts)
+}
+
+// Calculate evaluates the expression and returns the formatted result
+func Calculate(Expr string, opts Options) (string, error) {
+	result, err := CalculateResult(Expr, opts)
+	return result.Text, err
+}
+
+// CalculateResult evaluates the expression and returns both the formatted
+// result and its value. An assignment such as x = 5 evaluates its right
+// hand side and names the variable in the result.
+func CalculateResult(Expr string, opts Options) (Result, error) {
+	return CalculateContext(context.Background(), Expr, opts)
+}
+
+// CalculateContext is CalculateResult, giving up with ErrTimeout once ctx
+// passes its deadline
+//
+// Statements separated by ';', such as x = 5; y = 3; x * y, are evaluated
+// in order, each seeing the variables assigned and the ans computed by the
+// ones before. The result is the last statement's, and empty statements
+// between them are ignored. A ';' ending the input is a trailing separator
+// rather than an empty statement, see Options.LenientSeparators.
+func CalculateContext(ctx context.Context, Expr string, opts Options) (Result, error) {
+	Expr, err := trailingStatementSeparator(Expr, opts.LenientSeparators)
+	if err != nil {
+		return Result{}, err
+	}
+
+	statements := splitStatements(Expr)
+	var numbers []int
+	for i, statement := range statements {
+		if strings.TrimSpace(statement) != "" {
+			numbers = append(numbers, i)
+		}
+	}
+
+	offsets := statementOffsets(statements)
+
+	switch len(numbers) {
+	case 0:
+		return Result{}, ErrEmptyExpression
+	case 1:
+		result, err := calculateStatement(ctx, statements[numbers[0]], opts)
+		return result, shiftPosition(err, offsets[numbers[0]])
+	}
+
+	opts.Vars = maps.Clone(opts.Vars)
+	if opts.Vars == nil {
+		opts.Vars = make(map[string]float64)
+	}
+	assigned := make(map[string]float64)
+
+	var result Result
+	for _, i := range numbers {
+		var err error
+		if result, err = calculateStatement(ctx, statements[i], opts); err != nil {
+			return Result{}, fmt.Errorf("statement %d: %w", i+1, shiftPosition(err, offsets[i]))
+		}
+
+		opts.Vars[Ans] = result.Value
+		if result.Assigned != "" {
+			opts.Vars[result.Assigned] = result.Value
+			assigned[result.Assigned] = result.Value
+		}
+	}
+
+	if len(assigned) > 0 {
+		result.Vars = assigned
+	}
+	return result, nil
+}
+
+// Check reports whether the input would parse, without evaluating it. Each
+// statement may use the variables assigned by the ones before, and ans if a
+// statement precedes it.
+func Check(Expr string, opts Options) error {
+	Expr, err := trailingStatementSeparator(Expr, opts.LenientSeparators)
+	if err != nil {
+		return err
+	}
+
+	statements := splitStatements(Expr)
+	offsets := statementOffsets(statements)
+	opts.Vars = maps.Clone(opts.Vars)
+	if opts.Vars == nil {
+		opts.Vars = make(map[string]float64)
+	}
+
+	checked := 0
+	for i, statement := range statements {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+
+		name, value, err := SplitAssignment(statement, opts)
+		if err == nil {
+			_, err = parse(value, opts)
+			err = shiftPosition(err, utf8.RuneCountInString(statement)-utf8.RuneCountInString(value)+offsets[i])
+		}
+		if err != nil {
+			if len(statements) > 1 {
+				return fmt.Errorf("statement %d: %w", i+1, err)
+			}
+			return err
+		}
+
+		checked++
+		opts.Vars[Ans] = 0
+		if name != "" {
+			opts.Vars[name] = 0
+		}
+	}
+
+	if checked == 0 {
+		return ErrEmptyExpression
+	}
+	return nil
+}
+
+// calculateStatement evaluates a single statement, which may be an
+// assignment
+func calculateStatement(ctx context.Context, Expr string, opts Options) (Result, error) {
+	name, value, err := SplitAssignment(Expr, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	// Positions are counted from the start of the statement
+	result, err := calculate(ctx, value, opts)
+	result.Assigned = name
+	return result, shiftPosition(err, utf8.RuneCountInString(Expr)-utf8.RuneCountInString(value))
+}
+
+// trailingStatementSeparator handles a ';' ending the input, which would
+// otherwise be an empty statement and ignored. When lenient a single one is
+// dropped, otherwise it is rejected like any other trailing separator.
+func trailingStatementSeparator(Expr string, lenient bool) (string, error) {
+	trimmed := strings.TrimRightFunc(Expr, unicode.IsSpace)
+	if !strings.HasSuffix(trimmed, ";") {
+		return Expr, nil
+	}
+
+	trimmed = strings.TrimSuffix(trimmed, ";")
+	rest := strings.TrimRightFunc(trimmed, unicode.IsSpace)
+	if !lenient {
+		return "", errorAt(utf8.RuneCountInString(trimmed)+1, errTrailingSeparator(';'))
+	}
+	if strings.HasSuffix(rest, ";") {
+		return "", errorAt(utf8.RuneCountInString(rest), errTrailingSeparator(';'))
+	}
+	return trimmed, nil
+}
+
+// splitStatements splits the input at each ';' outside parentheses. With a
+// decimal comma, ';' inside parentheses separates function arguments.
+func splitStatements(Expr string) []string {
+	var statements []string
+	depth, start := 0, 0
+	for i, ch := range Expr {
+		switch ch {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ';':
+			if depth == 0 {
+				statements = append(statements, Expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(statements, Expr[start:])
+}
+
+// Statements returns the ';' separated statements of the input, leaving
+// out empty ones
+func Statements(Expr string) []string {
+	var statements []string
+	for _, statement := range splitStatements(Expr) {
+		if strings.TrimSpace(statement) != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// statementOffsets returns the number of characters before each statement
+// in the input they were split from
+func statementOffsets(statements []string) []int {
+	offsets := make([]int, len(statements))
+	for i := 1; i < len(statements); i++ {
+		offsets[i] = offsets[i-1] + utf8.RuneCountInString(statements[i-1]) + 1
+	}
+	return offsets
+}
+
+// SplitAssignment separates an assignment such as x = 5 into the variable
+// name and the expression assigned. Expressions without an assigning '=',
+// such as x == 5, are returned unchanged with an empty name.
+func SplitAssignment(Expr string, opts Options) (string, string, error) {
+	i := assignmentIndex(Expr)
+	if i < 0 {
+		return "", Expr, nil
+	}
+	name, value := Expr[:i], Expr[i+1:]
+
+	name = strings.TrimSpace(name)
+	if err := CheckVariableName(name, opts); err != nil {
+		return "", "", err
+	}
+	return name, value, nil
+}
+
+// CheckVariableName reports whether name may be bound as a variable: it
+// must be letters only and not a constant, function or other reserved name
+func CheckVariableName(name string, opts Options) error {
+	switch {
+	case name == "" || strings.IndexFunc(name, func(ch rune) bool { return !unicode.IsLetter(ch) }) >= 0:
+		return fmt.Errorf("invalid variable name %q, names are letters only", name)
+	case isReserved(name, opts):
+		return fmt.Errorf("%s is reserved and can't be assigned", name)
+	}
+	return nil
+}
+
+// assignmentIndex returns the index of the '=' that assigns, skipping the
+// comparisons ==, !=, <= and >= and a leading '=' as in =1+2, or -1 if
+// there is none
+func assignmentIndex(Expr string) int {
+	for i := 0; i < len(Expr); i++ {
+		switch {
+		case Expr[i] != '=':
+		case strings.TrimSpace(Expr[:i]) == "" && !strings.HasPrefix(Expr[i+1:], "="):
+		case i+1 < len(Expr) && Expr[i+1] == '=':
+			i++
+		case i > 0 && strings.ContainsRune("<>!", rune(Expr[i-1])):
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+// isReserved reports whether the name is a constant, function or ans
+func isReserved(name string, opts Options) bool {
+	_, builtin := constants[name]
+	_, physics := physicsConstants[name]
+	return builtin || isFunction(name) || name == Ans || name == Memory || (opts.Physics && physics) || (opts.Complex && name == imaginaryUnit)
+}
+
+// calculate evaluates an expression without assignment
+func calculate(ctx context.Context, Expr string, opts Options) (Result, error) {
+	if opts.Precision < 0 || opts.Precision > MaxPrecision {
+		return Result{}, fmt.Errorf("precision must be between 0 and %d", MaxPrecision)
+	}
+	if opts.SigFigs < 0 || opts.SigFigs > MaxSigFigs {
+		return Result{}, fmt.Errorf("significant figures must be between 1 and %d", MaxSigFigs)
+	}
+	if opts.ExactDigits < 0 || opts.ExactDigits > MaxExactDigits {
+		return Result{}, fmt.Errorf("exact digits must be between 0 and %d", MaxExactDigits)
+	}
+
+	// A variable named i would hide the imaginary unit
+	if _, bound := opts.Vars[imaginaryUnit]; opts.Complex && bound {
+		opts.Vars = maps.Clone(opts.Vars)
+		delete(opts.Vars, imaginaryUnit)
+	}
+
+	tree, err := parse(Expr, opts)
+	if err != nil {
+		return Result{}, err
+	}
+
+	if opts.Complex {
+		result, err := evaluateComplex(ctx, tree, opts.Angle)
+		if err != nil {
+			return Result{}, err
+		}
+		if err := CheckFinite(real(result)); err != nil {
+			return Result{}, err
+		}
+		if err := CheckFinite(imag(result)); err != nil {
+			return Result{}, err
+		}
+		return Result{Text: formatComplex(result, opts.Precision, opts.Rounding), Value: real(result)}, nil
+	}
+
+	if opts.Exact {
+		result, err := evaluateRat(ctx, tree)
+		if err != nil {
+			return Result{}, err
+		}
+		value, _ := result.Float64()
+		return Result{Text: formatRat(result, opts.ExactDigits), Value: value, Fraction: result.RatString()}, nil
+	}
+
+	if opts.Fractions && isIntegerArithmetic(tree) {
+		result, err := evaluateRat(ctx, tree)
+		if err != nil {
+			return Result{}, err
+		}
+		value, _ := result.Float64()
+		return Result{Text: result.RatString(), Value: value, Fraction: result.RatString()}, nil
+	}
+
+	if opts.Decimal {
+		result, err := evaluateDecimal(ctx, tree, opts.Scale)
+		if err != nil {
+			return Result{}, err
+		}
+		value, _ := strconv.ParseFloat(result.String(), 64)
+		return Result{Text: result.String(), Value: value}, nil
+	}
+
+	var steps *trace
+	if opts.Steps {
+		steps = &trace{format: func(val float64) string { return formatResult(val, opts) }}
+	}
+
+	result, err := evalTree(ctx, tree, opts.Angle, steps, opts.Partial)
+	if err != nil {
+		return Result{}, err
+	}
+	if err := CheckFinite(result); err != nil {
+		return Result{}, err
+	}
+
+	formatted := Result{Text: formatResult(result, opts), Value: result}
+	if steps != nil {
+		formatted.Steps = steps.steps
+	}
+	return formatted, nil
+}
+
+// FormatFloat rounds val to precision decimal places with the given mode and
+// formats it without trailing fractional zeros
+func FormatFloat(val float64, precision int, mode RoundingMode) string {
+	formatted := strconv.FormatFloat(RoundFloat(val, uint(precision), mode), 'f', precision, 64)
+	if strings.Contains(formatted, ".") {
+		formatted = strings.TrimRight(strings.TrimRight(formatted, "0"), ".")
+	}
+	return formatted
+}
+
+// FormatSigFigs rounds val to digits significant figures with the given mode
+// and formats it without an exponent. Trailing zeros are significant and
+// kept, so 1.5 to 3 figures is 1.50, and 123456 to 3 figures is 123000.
+func FormatSigFigs(val float64, digits int, mode RoundingMode) string {
+	rounded := RoundSigFigs(val, digits, mode)
+	if rounded == 0 {
+		return strconv.FormatFloat(0, 'f', digits-1, 64)
+	}
+
+	// Take the digits from scientific notation, since large values printed
+	// in full show float64 noise, eg. 12345678901234599936
+	scientific := strconv.FormatFloat(math.Abs(rounded), 'e', digits-1, 64)
+	mantissa, exponentText, _ := strings.Cut(scientific, "e")
+	mantissa = strings.Replace(mantissa, ".", "", 1)
+	exponent, _ := strconv.Atoi(exponentText)
+
+	var formatted string
+	switch {
+	case exponent >= digits-1:
+		formatted = mantissa + strings.Repeat("0", exponent-(digits-1))
+	case exponent < 0:
+		formatted = "0." + strings.Repeat("0", -exponent-1) + mantissa
+	default:
+		formatted = mantissa[:exponent+1] + "." + mantissa[exponent+1:]
+	}
+
+	if rounded < 0 {
+		return "-" + formatted
+	}
+	return formatted
+}
+
+// formatResult formats a float64 result to the significant figures or
+// decimal places selected by opts
+func formatResult(val float64, opts Options) string {
+	if opts.SigFigs > 0 {
+		return FormatSigFigs(val, opts.SigFigs, opts.Rounding)
+	}
+	return FormatFloat(val, opts.Precision, opts.Rounding)
+}
+
+// parse normalizes and validates the expression and builds its tree
+func parse(Expr string, opts Options) (*Node, error) {
+	original := Expr
+	Expr, err := Preprocess(Expr, PreprocessorsFor(opts))
+	if err != nil {
+		return nil, err
+	}
+	if Expr == "" {
+		return nil, ErrEmptyExpression
+	}
+
+	if err := Validate(Expr, opts); err != nil {
+		return nil, InOriginal(err, original, Expr, opts)
+	}
+
+	tokens, err := TokenizeWith(Expr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return bindVars(BuildTree(tokens), opts.Vars), nil
+}
+
+// Tokens returns the tokens of the expression, or of the value of an
+// assignment, once preprocessed. Error positions are in Expr as given.
+func Tokens(Expr string, opts Options) ([]string, error) {
+	_, value, err := SplitAssignment(Expr, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	offset := utf8.RuneCountInString(Expr) - utf8.RuneCountInString(value)
+	processed, err := Preprocess(value, PreprocessorsFor(opts))
+	if err != nil {
+		return nil, shiftPosition(err, offset)
+	}
+
+	tokens, err := TokenizeWith(processed, opts)
+	if err != nil {
+		return nil, shiftPosition(InOriginal(err, value, processed, opts), offset)
+	}
+	return tokens, nil
+}
+
+// Parse validates the expression with the default options and builds its
+// tree, for evaluating many times with EvalTree. Names that aren't
+// constants or functions are free variables, left for EvalTree to bind.
+func Parse(Expr string) (*Node, error) {
+	opts := DefaultOptions()
+	original := Expr
+	Expr, err := Preprocess(Expr, PreprocessorsFor(opts))
+	if err != nil {
+		return nil, err
+	}
+	if Expr == "" {
+		return nil, ErrEmptyExpression
+	}
+
+	if err := validate(Expr, opts, func(string) bool { return true }); err != nil {
+		return nil, InOriginal(err, original, Expr, opts)
+	}
+
+	tokens, err := TokenizeWith(Expr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return BuildTree(tokens), nil
+}
+
+// freeName returns the first name in the tree that is neither a constant
+// nor bound by bindVars, or "" if there is none
+func freeName(node *Node) string {
+	if node == nil {
+		return ""
+	}
+
+	for _, arg := range node.Args {
+		if name := freeName(arg); name != "" {
+			return name
+		}
+	}
+
+	if node.Left == nil && node.Right == nil && !node.IsCall() && isOperand(node.Value) && !isNumeric(node.Value) && !isRadixLiteral(node.Value) && !isConstant(node.Value) {
+		return node.Value
+	}
+
+	if name := freeName(node.Left); name != "" {
+		return name
+	}
+	return freeName(node.Right)
+}
+
+// bindVars returns a copy of the tree with every name bound in vars
+// replaced by its value
+func bindVars(node *Node, vars map[string]float64) *Node {
+	if node == nil || len(vars) == 0 {
+		return node
+	}
+
+	if node.IsCall() {
+		args := make([]*Node, len(node.Args))
+		for i, arg := range node.Args {
+			args[i] = bindVars(arg, vars)
+		}
+		return &Node{Value: node.Value, Args: args}
+	}
+
+	if node.Left == nil && node.Right == nil {
+		val, exists := vars[node.Value]
+		if !exists {
+			return node
+		}
+		return &Node{Value: strconv.FormatFloat(val, 'g', -1, 64)}
+	}
+
+	return &Node{Value: node.Value, Left: bindVars(node.Left, vars), Right: bindVars(node.Right, vars)}
+}
@@ -0,0 +1,222 @@
+package calc
+
+import "testing"
+
+// calcCase is an expression and the result text it gives, or the error
+// when err is set
+type calcCase struct {
+	expr string
+	want string
+	err  string
+}
+
+// checkCases calculates each case with opts and compares the outcome
+func checkCases(t *testing.T, opts Options, cases []calcCase) {
+	t.Helper()
+	for _, tc := range cases {
+		result, err := CalculateResult(tc.expr, opts)
+		switch {
+		case tc.err != "" && err == nil:
+			t.Errorf("%s = %s, want error %q", tc.expr, result.Text, tc.err)
+		case tc.err != "" && err.Error() != tc.err:
+			t.Errorf("%s: error %q, want %q", tc.expr, err, tc.err)
+		case tc.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %q", tc.expr, err)
+		case tc.err == "" && result.Text != tc.want:
+			t.Errorf("%s = %s, want %s", tc.expr, result.Text, tc.want)
+		}
+	}
+}
+
+func TestUnaryMinusPower(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "-2^2", want: "-4"},
+		{expr: "-(2)^2", want: "-4"},
+		{expr: "(-2)^2", want: "4"},
+		{expr: "x=2; -x^2", want: "-4"},
+		{expr: "-pi^2", want: "-9.8696"},
+		{expr: "2*-2^2", want: "-8"},
+		{expr: "2^-2^2", want: "0.0625"},
+		{expr: "-2^-2", want: "-0.25"},
+		{expr: "--2^2", want: "4"},
+		{expr: "1-2^2", want: "-3"},
+		{expr: "-e^0", want: "-1"},
+	})
+}
+
+func TestUnaryMinusPowerModes(t *testing.T) {
+	exact := DefaultOptions()
+	exact.Exact = true
+	checkCases(t, exact, []calcCase{
+		{expr: "-2^2", want: "-4"},
+		{expr: "2^-2^2", want: "1/16"},
+	})
+
+	cplx := DefaultOptions()
+	cplx.Complex = true
+	checkCases(t, cplx, []calcCase{
+		{expr: "-2^2", want: "-4"},
+		{expr: "-i^2", want: "1"},
+	})
+
+	dec := DefaultOptions()
+	dec.Decimal = true
+	checkCases(t, dec, []calcCase{
+		{expr: "-2-3", want: "-5"},
+		{expr: "-2^2", want: "-4"},
+		{expr: "2^-2^2", want: "0.0625"},
+	})
+}
+
+func TestFactorial(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "5!", want: "120"},
+		{expr: "0!", want: "1"},
+		{expr: "3!!", want: "720"},
+		{expr: "5!-3!", want: "114"},
+		{expr: "2^3!", want: "64"},
+		{expr: "-3!", want: "-6"},
+		{expr: "-(3)!", want: "-6"},
+		{expr: "-sqrt(4)!", want: "-2"},
+		{expr: "x=3; -x!", want: "-6"},
+		{expr: "-2!^2", want: "-4"},
+		{expr: "(-3)!", err: "factorial requires a non-negative integer"},
+		{expr: "3.5!", err: "factorial requires a non-negative integer"},
+		{expr: "171!", err: "factorial overflow, 170! is the largest that fits in a float64"},
+	})
+}
+
+func TestNodeString(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "1 + 2 * 3", want: "(1 + (2 * 3))"},
+		{expr: "-2^2", want: "(-(2 ^ 2))"},
+		{expr: "2^-2", want: "(2 ^ (-2))"},
+		{expr: "sqrt(-4)", want: "sqrt(-4)"},
+		{expr: "sqrt(1+3)", want: "sqrt(1 + 3)"},
+		{expr: "sqrt(3!)", want: "sqrt(3!)"},
+		{expr: "max(-1, 2)", want: "max((-1), 2)"},
+	}
+	for _, tc := range tests {
+		tree, err := Parse(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got := tree.String(); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestPhysicsConstants(t *testing.T) {
+	physics := DefaultOptions()
+	physics.Physics = true
+	checkCases(t, physics, []calcCase{
+		{expr: "c", want: "299792458"},
+		{expr: "2c", want: "599584916"},
+		{expr: "0.5*g*3(3)", want: "44.1299"},
+		{expr: "h/1e-34", want: "6.6261"},
+		{expr: "G/1e-11", want: "6.6743"},
+		{expr: "k/1e-23", want: "1.3806"},
+		{expr: "c = 3", err: "c is reserved and can't be assigned"},
+	})
+
+	// Off by default, so the names are free for variables
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "2c", err: "unknown name: c at position 2"},
+		{expr: "c = 3; 2c", want: "6"},
+	})
+
+	physics.Exact = true
+	checkCases(t, physics, []calcCase{
+		{expr: "2c", want: "599584916"},
+		{expr: "g", want: "196133/20000"},
+	})
+}
+
+func TestFormatSigFigs(t *testing.T) {
+	tests := []struct {
+		val    float64
+		digits int
+		mode   RoundingMode
+		want   string
+	}{
+		{val: 123456, digits: 3, want: "123000"},
+		{val: -123456, digits: 2, want: "-120000"},
+		{val: 0.00012345, digits: 3, want: "0.000123"},
+		{val: 1.23456e-10, digits: 3, want: "0.000000000123"},
+		{val: 1.5, digits: 3, want: "1.50"},
+		{val: 0, digits: 3, want: "0.00"},
+		{val: 9.999, digits: 3, want: "10.0"},
+		{val: 999.5, digits: 3, want: "1000"},
+		{val: 1e20, digits: 3, want: "100000000000000000000"},
+		{val: 12345678901234567890, digits: 5, want: "12346000000000000000"},
+		{val: 123456, digits: 3, mode: RoundFloor, want: "123000"},
+		{val: -123456, digits: 3, mode: RoundFloor, want: "-124000"},
+		{val: 121, digits: 2, mode: RoundCeil, want: "130"},
+		{val: 129, digits: 2, mode: RoundTrunc, want: "120"},
+	}
+	for _, tc := range tests {
+		mode := tc.mode
+		if mode == "" {
+			mode = RoundHalfAwayFromZero
+		}
+		if got := FormatSigFigs(tc.val, tc.digits, mode); got != tc.want {
+			t.Errorf("%v to %d figures (%s): %s, want %s", tc.val, tc.digits, mode, got, tc.want)
+		}
+	}
+}
+
+func TestSigFigs(t *testing.T) {
+	opts := DefaultOptions()
+	opts.SigFigs = 3
+	checkCases(t, opts, []calcCase{
+		{expr: "1/3", want: "0.333"},
+		{expr: "123456", want: "123000"},
+		{expr: "2/3*1e6", want: "667000"},
+		{expr: "1/7e5", want: "0.00000143"},
+	})
+
+	opts.SigFigs = MaxSigFigs + 1
+	checkCases(t, opts, []calcCase{
+		{expr: "1", err: "significant figures must be between 1 and 15"},
+	})
+}
+
+func TestOverflow(t *testing.T) {
+	power := "exponentiation overflow, the result is too large for a float64"
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "170! > 7.2e306", want: "1"},
+		{expr: "171!", err: "factorial overflow, 170! is the largest that fits in a float64"},
+		{expr: "2^1023 > 8.9e307", want: "1"},
+		{expr: "2^1024", err: power},
+		{expr: "10^308 > 9.9e307", want: "1"},
+		{expr: "10^309", err: power},
+		{expr: "(-10)^309", err: power},
+		{expr: "pow(10, 400)", err: power},
+		{expr: "10^-400", want: "0"},
+		{expr: "0^-1", err: "division by zero"},
+		{expr: "1e308*10", err: "result overflowed"},
+	})
+}
+
+func TestPercent(t *testing.T) {
+	percent := DefaultOptions()
+	percent.Percent = true
+	checkCases(t, percent, []calcCase{
+		{expr: "50%", want: "0.5"},
+		{expr: "200+10%", want: "220"},
+		{expr: "200-10%", want: "180"},
+		{expr: "200*10%", want: "20"},
+		{expr: "200/50%", want: "400"},
+		{expr: "(50+50)%", want: "1"},
+	})
+
+	// Without percent mode % is the remainder
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "7%3", want: "1"},
+	})
+}
@@ -0,0 +1,205 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/cmplx"
+	"strings"
+)
+
+// imaginaryUnit names i, the square root of -1, in complex mode
+const imaginaryUnit = "i"
+
+// complexFunctions are the functions with a complex form, such as sqrt(-1)
+// = i. Other functions only accept real arguments in complex mode.
+var complexFunctions = map[string]func(args []complex128) (complex128, error){
+	"sqrt": func(args []complex128) (complex128, error) { return cmplx.Sqrt(args[0]), nil },
+	"ln": func(args []complex128) (complex128, error) {
+		if args[0] == 0 {
+			return 0, errors.New("logarithm of zero")
+		}
+		return cmplx.Log(args[0]), nil
+	},
+	"sin": func(args []complex128) (complex128, error) { return cmplx.Sin(args[0]), nil },
+	"cos": func(args []complex128) (complex128, error) { return cmplx.Cos(args[0]), nil },
+	"tan": func(args []complex128) (complex128, error) { return cmplx.Tan(args[0]), nil },
+	"abs": func(args []complex128) (complex128, error) { return complex(cmplx.Abs(args[0]), 0), nil },
+	"pow": func(args []complex128) (complex128, error) { return cmplx.Pow(args[0], args[1]), nil },
+}
+
+// parseComplex converts a number, constant or i token to a complex number
+func parseComplex(token string) (complex128, error) {
+	switch token {
+	case imaginaryUnit:
+		return 1i, nil
+	case "-" + imaginaryUnit:
+		return -1i, nil
+	}
+
+	val, err := parseOperand(token)
+	return complex(val, 0), err
+}
+
+// realOperands returns the real parts of operands that have no imaginary
+// part, for operations only defined on the reals
+func realOperands(op string, operands ...complex128) ([]float64, error) {
+	reals := make([]float64, len(operands))
+	for i, z := range operands {
+		if imag(z) != 0 {
+			return nil, fmt.Errorf("%s requires real operands", op)
+		}
+		reals[i] = real(z)
+	}
+	return reals, nil
+}
+
+// evaluateComplex evaluates the tree over the complex numbers, with
+// trigonometric functions using the given angle unit
+func evaluateComplex(ctx context.Context, node *Node, angle AngleMode) (complex128, error) {
+	if node == nil {
+		return 0, nil
+	}
+	if err := checkContext(ctx); err != nil {
+		return 0, err
+	}
+
+	if node.IsCall() {
+		args := make([]complex128, len(node.Args))
+		for i, arg := range node.Args {
+			val, err := evaluateComplex(ctx, arg, angle)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = val
+		}
+		return callComplex(node.Value, args, angle)
+	}
+
+	// If it's a number, return it
+	if node.Left == nil && node.Right == nil {
+		return parseComplex(node.Value)
+	}
+
+	// Handle unary minus case
+	if node.Left == nil && node.Value == "-" {
+		val, err := evaluateComplex(ctx, node.Right, angle)
+		return -val, err
+	}
+
+	// Handle postfix factorial and percent
+	if node.Right == nil && (node.Value == "!" || isPercent(node)) {
+		val, err := evaluateComplex(ctx, node.Left, angle)
+		if err != nil {
+			return 0, err
+		}
+		if isPercent(node) {
+			return val / 100, nil
+		}
+
+		reals, err := realOperands("factorial", val)
+		if err != nil {
+			return 0, err
+		}
+		result, err := factorial(reals[0])
+		return complex(result, 0), err
+	}
+
+	// Evaluate left and right subtrees
+	leftVal, err := evaluateComplex(ctx, node.Left, angle)
+	if err != nil {
+		return 0, err
+	}
+	rightVal, err := evaluateComplex(ctx, node.Right, angle)
+	if err != nil {
+		return 0, err
+	}
+
+	// Adding or subtracting a percentage is relative to the left operand
+	if (node.Value == "+" || node.Value == "-") && isPercent(node.Right) {
+		rightVal *= leftVal
+	}
+
+	// Perform the operation
+	switch node.Value {
+	case "+":
+		return leftVal + rightVal, nil
+	case "-":
+		return leftVal - rightVal, nil
+	case "*":
+		return leftVal * rightVal, nil
+	case "/":
+		if rightVal == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return leftVal / rightVal, nil
+	case "^":
+		return cmplx.Pow(leftVal, rightVal), nil
+	case "==":
+		return complex(truth(leftVal == rightVal), 0), nil
+	case "!=":
+		return complex(truth(leftVal != rightVal), 0), nil
+	default:
+		reals, err := realOperands(node.Value, leftVal, rightVal)
+		if err != nil {
+			return 0, err
+		}
+		result, err := applyOperator(node.Value, reals[0], reals[1])
+		return complex(result, 0), err
+	}
+}
+
+// callComplex calls a function, using its complex form if it has one
+func callComplex(name string, args []complex128, angle AngleMode) (complex128, error) {
+	call, exists := complexFunctions[name]
+	if !exists {
+		reals, err := realOperands(name, args...)
+		if err != nil {
+			return 0, err
+		}
+		result, err := callFunction(name, reals, angle)
+		return complex(result, 0), err
+	}
+
+	if err := checkArity(name, len(args)); err != nil {
+		return 0, err
+	}
+	if functions[name].angleArgs && angle == Degrees {
+		if imag(args[0]) == 0 {
+			if err := checkDegrees(name, real(args[0])); err != nil {
+				return 0, err
+			}
+		}
+		converted := make([]complex128, len(args))
+		for i, arg := range args {
+			converted[i] = arg * math.Pi / 180
+		}
+		args = converted
+	}
+
+	return call(args)
+}
+
+// formatComplex renders z as a+bi, with each part rounded like FormatFloat
+// and zero parts left out
+func formatComplex(z complex128, precision int, mode RoundingMode) string {
+	re := FormatFloat(real(z), precision, mode)
+	im := FormatFloat(math.Abs(imag(z)), precision, mode)
+
+	switch {
+	case im == "0":
+		return re
+	case im == "1":
+		im = ""
+	}
+
+	sign := "+"
+	if imag(z) < 0 {
+		sign = "-"
+	}
+	if re == "0" {
+		return strings.TrimPrefix(sign, "+") + im + imaginaryUnit
+	}
+	return re + sign + im + imaginaryUnit
+}
@@ -0,0 +1,272 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// decimal is a base-10 fixed-point number equal to unscaled / 10^scale.
+// Every value in a calculation shares the same scale, so 0.1 and 0.2 are
+// stored exactly and their sum is exactly 0.3.
+type decimal struct {
+	unscaled *big.Int
+	scale    int
+}
+
+// pow10 returns 10^n
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// roundQuo divides n by d, rounding half away from zero like math.Round
+func roundQuo(n, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+
+	// Round up when the remainder is at least half the divisor
+	if new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+
+	return q
+}
+
+// decimalConstants holds the built-in constants to more digits than float64
+// keeps, so they are accurate to any scale up to 100
+var decimalConstants = map[string]string{
+	"pi": "3.141592653589793238462643383279502884197169399375105820974944592307816406286208998628034825342117067982148",
+	"e":  "2.718281828459045235360287471352662497757247093699959574966967627724076630353547594571382178525166427427466",
+}
+
+// parseDecimal converts a number or constant token to a decimal at the given scale
+func parseDecimal(token string, scale int) (decimal, error) {
+	if digits, ok := decimalConstants[token]; ok {
+		token = digits
+	}
+	rat, ok := new(big.Rat).SetString(token)
+	if !ok {
+		// Constants are only known as float64, use their shortest exact form
+		val, err := parseOperand(token)
+		if err != nil {
+			return decimal{}, err
+		}
+		rat, _ = new(big.Rat).SetString(strconv.FormatFloat(val, 'g', -1, 64))
+	}
+
+	return ratDecimal(rat, scale), nil
+}
+
+func (d decimal) add(o decimal) decimal {
+	return decimal{unscaled: new(big.Int).Add(d.unscaled, o.unscaled), scale: d.scale}
+}
+
+func (d decimal) sub(o decimal) decimal {
+	return decimal{unscaled: new(big.Int).Sub(d.unscaled, o.unscaled), scale: d.scale}
+}
+
+func (d decimal) mul(o decimal) decimal {
+	product := new(big.Int).Mul(d.unscaled, o.unscaled)
+	return decimal{unscaled: roundQuo(product, pow10(d.scale)), scale: d.scale}
+}
+
+func (d decimal) div(o decimal) (decimal, error) {
+	if o.unscaled.Sign() == 0 {
+		return decimal{}, errors.New("division by zero")
+	}
+
+	num := new(big.Int).Mul(d.unscaled, pow10(d.scale))
+	return decimal{unscaled: roundQuo(num, o.unscaled), scale: d.scale}, nil
+}
+
+// floorDiv returns d / o rounded toward negative infinity
+func (d decimal) floorDiv(o decimal) (decimal, error) {
+	if o.unscaled.Sign() == 0 {
+		return decimal{}, errors.New("division by zero")
+	}
+
+	q, r := new(big.Int).QuoRem(d.unscaled, o.unscaled, new(big.Int))
+	if r.Sign() != 0 && r.Sign() != o.unscaled.Sign() {
+		q.Sub(q, big.NewInt(1))
+	}
+	return decimal{unscaled: q.Mul(q, pow10(d.scale)), scale: d.scale}, nil
+}
+
+// mod returns the remainder of d / o, taking the sign of d like math.Mod
+func (d decimal) mod(o decimal) (decimal, error) {
+	if o.unscaled.Sign() == 0 {
+		return decimal{}, errors.New("division by zero")
+	}
+
+	return decimal{unscaled: new(big.Int).Rem(d.unscaled, o.unscaled), scale: d.scale}, nil
+}
+
+// maxDecimalFactorial bounds the operand of factorial in decimal mode,
+// where there is no float64 overflow to stop it
+const maxDecimalFactorial = 1000
+
+// factorial computes d! for a non-negative integer d
+func (d decimal) factorial() (decimal, error) {
+	n, rem := new(big.Int).QuoRem(d.unscaled, pow10(d.scale), new(big.Int))
+	if d.unscaled.Sign() < 0 || rem.Sign() != 0 {
+		return decimal{}, errors.New("factorial requires a non-negative integer")
+	}
+	if n.Cmp(big.NewInt(maxDecimalFactorial)) > 0 {
+		return decimal{}, errors.New("factorial overflow")
+	}
+
+	result := new(big.Int).MulRange(1, n.Int64())
+	return decimal{unscaled: result.Mul(result, pow10(d.scale)), scale: d.scale}, nil
+}
+
+// rat returns d as an exact fraction
+func (d decimal) rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.unscaled, pow10(d.scale))
+}
+
+// ratDecimal rounds r to a decimal at the given scale
+func ratDecimal(r *big.Rat, scale int) decimal {
+	num := new(big.Int).Mul(r.Num(), pow10(scale))
+	return decimal{unscaled: roundQuo(num, r.Denom()), scale: scale}
+}
+
+// pow raises d to an integer exponent, computed exactly then rounded
+func (d decimal) pow(o decimal) (decimal, error) {
+	exponent := o.rat()
+	if !exponent.IsInt() {
+		return decimal{}, errors.New("decimal mode only supports integer exponents")
+	}
+
+	result, err := ratPow(d.rat(), exponent)
+	if err != nil {
+		return decimal{}, err
+	}
+	return ratDecimal(result, d.scale), nil
+}
+
+// bitwise performs a bitwise operation or shift on integer operands
+func (d decimal) bitwise(op string, o decimal) (decimal, error) {
+	result, err := ratBitwise(op, d.rat(), o.rat())
+	if err != nil {
+		return decimal{}, err
+	}
+	return ratDecimal(result, d.scale), nil
+}
+
+func (d decimal) neg() decimal {
+	return decimal{unscaled: new(big.Int).Neg(d.unscaled), scale: d.scale}
+}
+
+// String formats the decimal without trailing fractional zeros
+func (d decimal) String() string {
+	digits := new(big.Int).Abs(d.unscaled).String()
+	if len(digits) <= d.scale {
+		digits = strings.Repeat("0", d.scale-len(digits)+1) + digits
+	}
+
+	intPart, fracPart := digits[:len(digits)-d.scale], strings.TrimRight(digits[len(digits)-d.scale:], "0")
+
+	result := intPart
+	if fracPart != "" {
+		result += "." + fracPart
+	}
+	if d.unscaled.Sign() < 0 {
+		result = "-" + result
+	}
+
+	return result
+}
+
+// evaluateDecimal evaluates the tree in base-10 fixed-point arithmetic
+func evaluateDecimal(ctx context.Context, node *Node, scale int) (decimal, error) {
+	if node == nil {
+		return decimal{unscaled: new(big.Int), scale: scale}, nil
+	}
+	if err := checkContext(ctx); err != nil {
+		return decimal{}, err
+	}
+
+	// Functions have no exact base-10 form
+	if node.IsCall() {
+		return decimal{}, fmt.Errorf("%s is not supported in decimal mode", node.Value)
+	}
+
+	// If it's a number, return it
+	if node.Left == nil && node.Right == nil {
+		return parseDecimal(node.Value, scale)
+	}
+
+	// Handle unary minus case
+	if node.Left == nil && node.Value == "-" {
+		val, err := evaluateDecimal(ctx, node.Right, scale)
+		if err != nil {
+			return decimal{}, err
+		}
+		return val.neg(), nil
+	}
+
+	// Handle postfix factorial
+	if node.Right == nil && node.Value == "!" {
+		val, err := evaluateDecimal(ctx, node.Left, scale)
+		if err != nil {
+			return decimal{}, err
+		}
+		return val.factorial()
+	}
+
+	// Handle postfix percent
+	if isPercent(node) {
+		val, err := evaluateDecimal(ctx, node.Left, scale)
+		if err != nil {
+			return decimal{}, err
+		}
+		return decimal{unscaled: roundQuo(val.unscaled, big.NewInt(100)), scale: scale}, nil
+	}
+
+	// Evaluate left and right subtrees
+	leftVal, err := evaluateDecimal(ctx, node.Left, scale)
+	if err != nil {
+		return decimal{}, err
+	}
+	rightVal, err := evaluateDecimal(ctx, node.Right, scale)
+	if err != nil {
+		return decimal{}, err
+	}
+
+	// Adding or subtracting a percentage is relative to the left operand
+	if (node.Value == "+" || node.Value == "-") && isPercent(node.Right) {
+		rightVal = leftVal.mul(rightVal)
+	}
+
+	// Perform the operation
+	switch node.Value {
+	case "+":
+		return leftVal.add(rightVal), nil
+	case "-":
+		return leftVal.sub(rightVal), nil
+	case "*":
+		return leftVal.mul(rightVal), nil
+	case "/":
+		return leftVal.div(rightVal)
+	case "//":
+		return leftVal.floorDiv(rightVal)
+	case "%":
+		return leftVal.mod(rightVal)
+	case "^":
+		return leftVal.pow(rightVal)
+	case "&", "|", "<<", ">>":
+		return leftVal.bitwise(node.Value, rightVal)
+	case "<", ">", "<=", ">=", "==", "!=":
+		// Both operands share the scale, so their unscaled values order them
+		result := int64(compare(node.Value, leftVal.unscaled.Cmp(rightVal.unscaled)))
+		return decimal{unscaled: new(big.Int).Mul(big.NewInt(result), pow10(scale)), scale: scale}, nil
+	default:
+		return decimal{}, errors.New("unknown operator: " + node.Value)
+	}
+}
@@ -0,0 +1,83 @@
+package calc
+
+import "testing"
+
+func TestDecimalMode(t *testing.T) {
+	dec := DefaultOptions()
+	dec.Decimal = true
+	checkCases(t, dec, []calcCase{
+		{expr: "0.1 + 0.2", want: "0.3"},
+		{expr: "0.1 + 0.7", want: "0.8"},
+		{expr: "0.3 - 0.1", want: "0.2"},
+		{expr: "0.1 * 3", want: "0.3"},
+		{expr: "1.1 * 1.1", want: "1.21"},
+		{expr: "1.005 * 1000", want: "1005"},
+		{expr: "-0.1 - 0.2", want: "-0.3"},
+		{expr: "1e-3 + 0.1", want: "0.101"},
+		{expr: "x = 0.1; x * 3", want: "0.3"},
+		{expr: "1/3", want: "0.33333333333333333333"},
+		{expr: "2/3", want: "0.66666666666666666667"},
+		{expr: "10 // 3", want: "3"},
+		{expr: "10 % 3", want: "1"},
+		{expr: "5!", want: "120"},
+		{expr: "1/0", err: "division by zero"},
+		{expr: "sqrt(2)", err: "sqrt is not supported in decimal mode"},
+		{expr: "2^3", want: "8"},
+		{expr: "1.1^2", want: "1.21"},
+		{expr: "0.1^3", want: "0.001"},
+		{expr: "(-2)^3", want: "-8"},
+		{expr: "2^-2", want: "0.25"},
+		{expr: "3^-1", want: "0.33333333333333333333"},
+		{expr: "2^100", want: "1267650600228229401496703205376"},
+		{expr: "2^0.5", err: "decimal mode only supports integer exponents"},
+		{expr: "0^-1", err: "division by zero"},
+		{expr: "(9^9999)^9999", err: ErrRatTooLarge.Error()},
+		{expr: "12 & 10", want: "8"},
+		{expr: "12 | 3", want: "15"},
+		{expr: "-1 & 255", want: "255"},
+		{expr: "2^70 | 1", want: "1180591620717411303425"},
+		{expr: "1.5 & 1", err: "& requires integer operands"},
+		{expr: "1 | 0.1", err: "| requires integer operands"},
+		{expr: "1 << 4", want: "16"},
+		{expr: "1 << 63", want: "9223372036854775808"},
+		{expr: "-16 >> 2", want: "-4"},
+		{expr: "255 >> 4", want: "15"},
+		{expr: "1 << 64", err: "shift count must be an integer between 0 and 63"},
+		{expr: "1 >> -1", err: "shift count must be an integer between 0 and 63"},
+		{expr: "1.5 << 1", err: "<< requires integer operands"},
+		{expr: "pi", want: "3.14159265358979323846"},
+		{expr: "e", want: "2.71828182845904523536"},
+		{expr: "2*pi", want: "6.28318530717958647692"},
+	})
+
+	dec.Scale = 2
+	checkCases(t, dec, []calcCase{
+		{expr: "1/3", want: "0.33"},
+		{expr: "2/3", want: "0.67"},
+		{expr: "pi", want: "3.14"},
+		{expr: "1.15^2", want: "1.32"},
+	})
+
+	dec.Scale = 50
+	checkCases(t, dec, []calcCase{
+		{expr: "pi", want: "3.14159265358979323846264338327950288419716939937511"},
+	})
+}
+
+func TestDecimalModeValue(t *testing.T) {
+	// The float sum is off in the last digit, which decimal mode isn't
+	a, b := 0.1, 0.2
+	if a+b == 0.3 {
+		t.Fatal("0.1 + 0.2 is exact in float64, so this test checks nothing")
+	}
+
+	opts := DefaultOptions()
+	opts.Decimal = true
+	result, err := CalculateResult("0.1 + 0.2", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Value != 0.3 {
+		t.Errorf("0.1 + 0.2 has value %v, want 0.3", result.Value)
+	}
+}
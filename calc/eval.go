@@ -0,0 +1,486 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// EvalTree evaluates an expression tree built by BuildTree or Parse, with
+// the names in vars bound to their values. The tree is flattened to postfix
+// order and evaluated with an explicit operand stack, so deep trees can't
+// exhaust the goroutine stack. Angles are in radians.
+func EvalTree(node *Node, vars map[string]float64) (float64, error) {
+	node = bindVars(node, vars)
+	if name := freeName(node); name != "" {
+		return 0, fmt.Errorf("unknown name: %s", name)
+	}
+	return evalTree(context.Background(), node, Radians, nil, false)
+}
+
+// trace records each operation of an evaluation as a step such as
+// 2 * 3 = 6, formatting values with format
+type trace struct {
+	steps  []string
+	format func(float64) string
+}
+
+// record adds the step for an operation that produced result
+func (t *trace) record(operation string, result float64) {
+	t.steps = append(t.steps, operation+" = "+t.format(result))
+}
+
+// evalTree evaluates the tree with trigonometric functions using the given
+// angle unit, stopping once ctx is done. When steps is not nil every
+// operation is recorded in evaluation order. When partial is set an error
+// is reported as an *EvalError naming the subexpression that failed, with
+// the values computed beside it.
+func evalTree(ctx context.Context, node *Node, angle AngleMode, steps *trace, partial bool) (float64, error) {
+	if node == nil {
+		return 0, nil
+	}
+
+	var failures *partialFailures
+	if partial {
+		failures = &partialFailures{}
+	}
+
+	var stack []float64
+	for _, n := range Postfix(node) {
+		if err := checkContext(ctx); err != nil {
+			return 0, err
+		}
+
+		if failures != nil && failures.propagate(n, &stack) {
+			continue
+		}
+
+		next, err := evalNode(n, stack, angle, steps)
+		switch {
+		case err != nil && failures == nil:
+			return 0, err
+		case err != nil:
+			failures.fail(n, &stack, err)
+		default:
+			stack = next
+			if failures != nil {
+				failures.succeed(n)
+			}
+		}
+	}
+
+	if failures != nil && failures.err != nil {
+		return 0, failures.err
+	}
+	return stack[0], nil
+}
+
+// evalNode applies the operation of n to its operands at the top of the
+// stack, returning the stack with them replaced by the result
+func evalNode(n *Node, stack []float64, angle AngleMode, steps *trace) ([]float64, error) {
+	switch {
+	case n.IsCall():
+		// Replace the arguments with the function's result
+		base := len(stack) - len(n.Args)
+		result, err := callFunction(n.Value, stack[base:], angle)
+		if err != nil {
+			return nil, err
+		}
+		if steps != nil {
+			args := make([]string, len(n.Args))
+			for i, arg := range stack[base:] {
+				args[i] = steps.format(arg)
+			}
+			steps.record(fmt.Sprintf("%s(%s)", n.Value, strings.Join(args, ", ")), result)
+		}
+		return append(stack[:base], result), nil
+	case n.Left == nil && n.Right == nil:
+		// If it's a number, push it
+		num, err := parseOperand(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		return append(stack, num), nil
+	case n.Left == nil || n.Right == nil:
+		// Unary minus and postfix factorial take one operand
+		operand := stack[len(stack)-1]
+		var result float64
+		var err error
+		switch {
+		case n.Value == "-":
+			result = -operand
+			if steps != nil {
+				steps.record("-("+steps.format(operand)+")", result)
+			}
+		case n.Value == "!":
+			result, err = factorial(operand)
+			if steps != nil && err == nil {
+				steps.record(steps.format(operand)+"!", result)
+			}
+		case n.Value == "%":
+			result = operand / 100
+			if steps != nil {
+				steps.record(steps.format(operand)+"%", result)
+			}
+		default:
+			err = errors.New("unknown operator: " + n.Value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		stack[len(stack)-1] = result
+		return stack, nil
+	default:
+		// Perform the binary operation
+		leftVal, rightVal := stack[len(stack)-2], stack[len(stack)-1]
+
+		// Adding or subtracting a percentage is relative to the left
+		// operand, so 200 + 10% is 200 + 20
+		if (n.Value == "+" || n.Value == "-") && isPercent(n.Right) {
+			rightVal *= leftVal
+		}
+
+		result, err := applyOperator(n.Value, leftVal, rightVal)
+		if err != nil {
+			return nil, err
+		}
+		if steps != nil {
+			steps.record(steps.format(leftVal)+" "+n.Value+" "+steps.format(rightVal), result)
+		}
+		stack = stack[:len(stack)-1]
+		stack[len(stack)-1] = result
+		return stack, nil
+	}
+}
+
+// operands returns the children of n, in the order their values are on the
+// stack when n is evaluated
+func operands(n *Node) []*Node {
+	switch {
+	case n.IsCall():
+		return n.Args
+	case n.Left == nil && n.Right == nil:
+		return nil
+	case n.Left == nil:
+		return []*Node{n.Right}
+	case n.Right == nil:
+		return []*Node{n.Left}
+	}
+	return []*Node{n.Left, n.Right}
+}
+
+// failState tells whether a value on the stack was computed, and if not
+// whether it depends on the error reported
+type failState int
+
+const (
+	computed failState = iota
+	failedFirst
+	failedLater
+)
+
+// partialFailures tracks the errors of a partial evaluation, which goes on
+// past the first so the values beside the failing subexpression are known.
+// Every node depending on a failure fails too, without being evaluated.
+type partialFailures struct {
+	// err is the first error, the one reported
+	err *EvalError
+	// states parallels the operand stack
+	states []failState
+}
+
+// propagate fails n without evaluating it if one of its operands failed,
+// recording its computed operands as siblings of the reported error if it
+// depends on it
+func (p *partialFailures) propagate(n *Node, stack *[]float64) bool {
+	children := operands(n)
+	base := len(p.states) - len(children)
+
+	state := computed
+	for _, s := range p.states[base:] {
+		if s != computed && state != failedFirst {
+			state = s
+		}
+	}
+	if state == computed {
+		return false
+	}
+
+	if state == failedFirst {
+		for i, child := range children {
+			if p.states[base+i] == computed {
+				p.err.Siblings = append(p.err.Siblings, SiblingValue{Expression: child.String(), Value: (*stack)[base+i]})
+			}
+		}
+	}
+
+	*stack = append((*stack)[:base], 0)
+	p.states = append(p.states[:base], state)
+	return true
+}
+
+// fail records that evaluating n itself failed with err
+func (p *partialFailures) fail(n *Node, stack *[]float64, err error) {
+	state := failedLater
+	if p.err == nil {
+		p.err = &EvalError{Subexpression: n.String(), Err: err}
+		state = failedFirst
+	}
+
+	base := len(p.states) - len(operands(n))
+	*stack = append((*stack)[:base], 0)
+	p.states = append(p.states[:base], state)
+}
+
+// succeed records that n was evaluated
+func (p *partialFailures) succeed(n *Node) {
+	p.states = append(p.states[:len(p.states)-len(operands(n))], computed)
+}
+
+// Postfix returns the nodes of the tree in postfix (reverse Polish) order,
+// children before their parent and function arguments in order
+func Postfix(node *Node) []*Node {
+	if node == nil {
+		return nil
+	}
+
+	var order []*Node
+	type frame struct {
+		node    *Node
+		visited bool
+	}
+	stack := []frame{{node: node}}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if top.visited {
+			order = append(order, top.node)
+			continue
+		}
+
+		// Push the node back behind its children, right first so the
+		// left subtree comes out first
+		n := top.node
+		stack = append(stack, frame{node: n, visited: true})
+		switch {
+		case n.IsCall():
+			for i := len(n.Args) - 1; i >= 0; i-- {
+				stack = append(stack, frame{node: n.Args[i]})
+			}
+		case n.Left == nil && n.Right == nil:
+			continue
+		case n.Left == nil:
+			stack = append(stack, frame{node: n.Right})
+		case n.Right == nil:
+			stack = append(stack, frame{node: n.Left})
+		default:
+			stack = append(stack, frame{node: n.Right}, frame{node: n.Left})
+		}
+	}
+
+	return order
+}
+
+// applyOperator performs a single binary operation
+func applyOperator(op string, leftVal, rightVal float64) (float64, error) {
+	switch op {
+	case "+":
+		return leftVal + rightVal, nil
+	case "-":
+		return leftVal - rightVal, nil
+	case "*":
+		return leftVal * rightVal, nil
+	case "/":
+		if rightVal == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return leftVal / rightVal, nil
+	case "//":
+		if rightVal == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return math.Floor(leftVal / rightVal), nil
+	case "%":
+		if rightVal == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return math.Mod(leftVal, rightVal), nil
+	case "^":
+		return power(leftVal, rightVal)
+	case "&", "|", "<<", ">>":
+		return applyBitwise(op, leftVal, rightVal)
+	case "<":
+		return truth(leftVal < rightVal), nil
+	case ">":
+		return truth(leftVal > rightVal), nil
+	case "<=":
+		return truth(leftVal <= rightVal), nil
+	case ">=":
+		return truth(leftVal >= rightVal), nil
+	case "==":
+		return truth(leftVal == rightVal), nil
+	case "!=":
+		return truth(leftVal != rightVal), nil
+	default:
+		return 0, errors.New("unknown operator: " + op)
+	}
+}
+
+// truth returns 1 for true and 0 for false, the results of comparisons
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// compare applies a comparison operator to the ordering of its operands,
+// as returned by a Cmp method
+func compare(op string, order int) float64 {
+	switch op {
+	case "<":
+		return truth(order < 0)
+	case ">":
+		return truth(order > 0)
+	case "<=":
+		return truth(order <= 0)
+	case ">=":
+		return truth(order >= 0)
+	case "==":
+		return truth(order == 0)
+	default:
+		return truth(order != 0)
+	}
+}
+
+// toInt64 converts an integral float64 to int64 for bitwise operations
+func toInt64(op string, val float64) (int64, error) {
+	if val != math.Trunc(val) || math.Abs(val) >= 1<<63 {
+		return 0, fmt.Errorf("%s requires integer operands", op)
+	}
+	return int64(val), nil
+}
+
+// applyBitwise performs a bitwise operation on integer operands
+func applyBitwise(op string, leftVal, rightVal float64) (float64, error) {
+	left, err := toInt64(op, leftVal)
+	if err != nil {
+		return 0, err
+	}
+	right, err := toInt64(op, rightVal)
+	if err != nil {
+		return 0, err
+	}
+
+	switch op {
+	case "&":
+		return float64(left & right), nil
+	case "|":
+		return float64(left | right), nil
+	}
+
+	// Shifts take a count between 0 and 63
+	if right < 0 || right > 63 {
+		return 0, errors.New("shift count must be an integer between 0 and 63")
+	}
+	if op == ">>" {
+		return float64(left >> right), nil
+	}
+
+	shifted := left << right
+	if shifted>>right != left {
+		return 0, errors.New("shift overflow")
+	}
+	return float64(shifted), nil
+}
+
+// SiblingValue is a subexpression that evaluated successfully next to the
+// one that failed
+type SiblingValue struct {
+	Expression string
+	Value      float64
+}
+
+// EvalError reports which subexpression failed during evaluation, along
+// with the values computed for its siblings on the way back up the tree
+type EvalError struct {
+	Subexpression string
+	Err           error
+	Siblings      []SiblingValue
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("%v in %s", e.Err, e.Subexpression)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// RoundSigFigs rounds val to digits significant figures with the given mode.
+// digits must be between 1 and MaxSigFigs.
+func RoundSigFigs(val float64, digits int, mode RoundingMode) float64 {
+	if val == 0 || math.IsInf(val, 0) || math.IsNaN(val) {
+		return val
+	}
+
+	// Scale so the digits kept are whole, dividing rather than multiplying
+	// by a fraction such as 0.001 which has no exact float64 form
+	shift := digits - 1 - decimalExponent(val)
+	ratio := math.Pow(10, math.Abs(float64(shift)))
+	if math.IsInf(ratio, 0) {
+		return val
+	}
+	if shift < 0 {
+		return RoundFloat(val/ratio, 0, mode) * ratio
+	}
+	return RoundFloat(val*ratio, 0, mode) / ratio
+}
+
+// decimalExponent returns the power of ten of the leading digit of val,
+// which is not zero. math.Log10 can't be used since it is inexact, eg.
+// math.Log10(1000) is just below 3.
+func decimalExponent(val float64) int {
+	formatted := strconv.FormatFloat(val, 'e', -1, 64)
+	exponent, _ := strconv.Atoi(formatted[strings.IndexByte(formatted, 'e')+1:])
+	return exponent
+}
+
+// RoundFloat rounds val to precision decimal places with the given mode.
+// An empty mode rounds half away from zero.
+func RoundFloat(val float64, precision uint, mode RoundingMode) float64 {
+	// Values this large have no fractional digits, and scaling them could overflow
+	if math.Abs(val) >= 1<<52 {
+		return val
+	}
+
+	// Multiplying can land just beside a whole number, eg. 1.1*100 is
+	// 110.00000000000001, which must not ceil to 111. Shifting the exponent
+	// of the shortest decimal form scales the digits the user sees instead.
+	mantissa, exponent, _ := strings.Cut(strconv.FormatFloat(val, 'e', -1, 64), "e")
+	shift, _ := strconv.Atoi(exponent)
+	scaled, _ := strconv.ParseFloat(mantissa+"e"+strconv.Itoa(shift+int(precision)), 64)
+	ratio := math.Pow(10, float64(precision))
+
+	switch mode {
+	case RoundFloor:
+		scaled = math.Floor(scaled)
+	case RoundCeil:
+		scaled = math.Ceil(scaled)
+	case RoundTrunc:
+		scaled = math.Trunc(scaled)
+	default:
+		scaled = math.Round(scaled)
+	}
+
+	// Avoid showing -0 when a small negative value rounds to zero
+	if scaled == 0 {
+		return 0
+	}
+	return scaled / ratio
+}
@@ -0,0 +1,163 @@
+package calc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPartialEvaluation(t *testing.T) {
+	tests := []struct {
+		expr          string
+		angle         AngleMode
+		subexpression string
+		siblings      []SiblingValue
+	}{
+		{expr: "1 + (2/0)", subexpression: "(2 / 0)", siblings: []SiblingValue{{"1", 1}}},
+		{expr: "(2/0) + 3*4", subexpression: "(2 / 0)", siblings: []SiblingValue{{"(3 * 4)", 12}}},
+		{expr: "(1/0) + (2/0)", subexpression: "(1 / 0)"},
+		{expr: "max(1, 2/0, 3) * 5", subexpression: "(2 / 0)", siblings: []SiblingValue{{"1", 1}, {"3", 3}, {"5", 5}}},
+		{expr: "((1/0) + 2) * ((5-5)/0) - 7", subexpression: "(1 / 0)", siblings: []SiblingValue{{"2", 2}, {"7", 7}}},
+		{expr: "sin(30) + 1/0", angle: Degrees, subexpression: "(1 / 0)", siblings: []SiblingValue{{"sin(30)", 0.49999999999999994}}},
+		{expr: "-sqrt(-4) * 2", subexpression: "sqrt(-4)", siblings: []SiblingValue{{"2", 2}}},
+		{expr: "x = 2; x + 1/(x-2)", subexpression: "(1 / (2 - 2))", siblings: []SiblingValue{{"2", 2}}},
+	}
+
+	for _, tc := range tests {
+		opts := DefaultOptions()
+		opts.Partial = true
+		if tc.angle != "" {
+			opts.Angle = tc.angle
+		}
+
+		_, err := CalculateResult(tc.expr, opts)
+		var evalErr *EvalError
+		if !errors.As(err, &evalErr) {
+			t.Errorf("%s: error %v, want an *EvalError", tc.expr, err)
+			continue
+		}
+		if evalErr.Subexpression != tc.subexpression {
+			t.Errorf("%s: failed in %s, want %s", tc.expr, evalErr.Subexpression, tc.subexpression)
+		}
+		if len(evalErr.Siblings) != len(tc.siblings) {
+			t.Errorf("%s: siblings %v, want %v", tc.expr, evalErr.Siblings, tc.siblings)
+			continue
+		}
+		for i, sibling := range evalErr.Siblings {
+			if sibling != tc.siblings[i] {
+				t.Errorf("%s: sibling %d is %v, want %v", tc.expr, i, sibling, tc.siblings[i])
+			}
+		}
+	}
+}
+
+func TestPartialEvaluationOff(t *testing.T) {
+	_, err := CalculateResult("1 + (2/0)", DefaultOptions())
+	var evalErr *EvalError
+	if errors.As(err, &evalErr) {
+		t.Errorf("error %v names the subexpression without Options.Partial", err)
+	}
+	if err == nil || err.Error() != "division by zero" {
+		t.Errorf("error %v, want division by zero", err)
+	}
+
+	opts := DefaultOptions()
+	opts.Partial = true
+	if result, err := CalculateResult("1 + 2", opts); err != nil || result.Text != "3" {
+		t.Errorf("1 + 2 = %q, %v with Options.Partial", result.Text, err)
+	}
+}
+
+// flatExpression returns 1+1+...+1 with the given number of tokens, which
+// must be odd
+func flatExpression(tokens int) string {
+	return strings.Repeat("1+", tokens/2) + "1"
+}
+
+func TestEvaluateFlat(t *testing.T) {
+	val, err := Evaluate(flatExpression(10001))
+	if err != nil || val != 5001 {
+		t.Errorf("got %v, %v, want 5001", val, err)
+	}
+}
+
+func BenchmarkEvaluateFlat(b *testing.B) {
+	expr := flatExpression(10001)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Evaluate(expr); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBuildTreeFlat(b *testing.B) {
+	tokens, err := Tokenize(flatExpression(10001))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if BuildTree(tokens) == nil {
+			b.Fatal("no tree built")
+		}
+	}
+}
+
+// reusedExpression is evaluated repeatedly by the EvalTree and Evaluate
+// benchmarks
+const reusedExpression = "sqrt(16) * (1 + 2/3)^2 - 5! + sin(pi/6)"
+
+func BenchmarkEvalTreeReused(b *testing.B) {
+	tree, err := Parse(reusedExpression)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EvalTree(tree, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvaluateReused(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, err := Evaluate(reusedExpression); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestRoundFloat(t *testing.T) {
+	tests := []struct {
+		val       float64
+		precision uint
+		mode      RoundingMode
+		want      float64
+	}{
+		{val: 1.5, mode: RoundHalfAwayFromZero, want: 2},
+		{val: -1.5, mode: RoundHalfAwayFromZero, want: -2},
+		{val: -1.5, mode: RoundFloor, want: -2},
+		{val: -1.5, mode: RoundCeil, want: -1},
+		{val: -1.5, mode: RoundTrunc, want: -1},
+		{val: 1.1, precision: 2, mode: RoundCeil, want: 1.1},
+		{val: -1.1, precision: 2, mode: RoundFloor, want: -1.1},
+		{val: 0.29, precision: 2, mode: RoundFloor, want: 0.29},
+		{val: 123456.78999, precision: 4, mode: RoundFloor, want: 123456.7899},
+		{val: 123456.78999, precision: 4, mode: RoundCeil, want: 123456.79},
+		{val: 123456.78999, precision: 4, mode: RoundTrunc, want: 123456.7899},
+		{val: -123456.78999, precision: 4, mode: RoundFloor, want: -123456.79},
+		{val: -123456.78999, precision: 4, mode: RoundCeil, want: -123456.7899},
+		{val: -123456.78999, precision: 4, mode: RoundTrunc, want: -123456.7899},
+		{val: 98765432.129, precision: 2, mode: RoundTrunc, want: 98765432.12},
+		{val: -98765432.121, precision: 2, mode: RoundFloor, want: -98765432.13},
+		{val: -0.00001, precision: 4, mode: RoundHalfAwayFromZero, want: 0},
+		{val: 1e300, precision: 4, mode: RoundFloor, want: 1e300},
+	}
+	for _, tc := range tests {
+		if got := RoundFloat(tc.val, tc.precision, tc.mode); got != tc.want {
+			t.Errorf("%v to %d places (%s): %v, want %v", tc.val, tc.precision, tc.mode, got, tc.want)
+		}
+	}
+}
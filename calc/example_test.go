@@ -0,0 +1,80 @@
+package calc_test
+
+import (
+	"fmt"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+func ExampleEval() {
+	result, err := calc.Eval("1 + 2 * 3")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(result.Value, result.Text)
+	// Output: 7 7
+}
+
+func ExampleEval_error() {
+	_, err := calc.Eval("1 + (2")
+	fmt.Println(err)
+	fmt.Println(calc.ErrorPosition(err))
+	// Output:
+	// unbalanced parentheses at position 5
+	// 5
+}
+
+func ExampleEvalWithOptions() {
+	opts := calc.DefaultOptions()
+	opts.Angle = calc.Degrees
+	result, err := calc.EvalWithOptions("sin(30) + 1/3", opts)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(result.Text)
+	// Output: 0.8333
+}
+
+func ExampleEvalWithOptions_exact() {
+	opts := calc.DefaultOptions()
+	opts.Exact = true
+	result, err := calc.EvalWithOptions("1/3 + 1/6", opts)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(result.Text)
+	// Output: 1/2
+}
+
+func ExampleEvaluate() {
+	val, err := calc.Evaluate("0.1 + 0.2")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(val)
+	// Output: 0.30000000000000004
+}
+
+func ExampleParse() {
+	tree, err := calc.Parse("2*x + 1")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, x := range []float64{1, 2, 3} {
+		y, err := calc.EvalTree(tree, map[string]float64{"x": x})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(y)
+	}
+	// Output:
+	// 3
+	// 5
+	// 7
+}
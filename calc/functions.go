@@ -0,0 +1,402 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// function is a supported function with the number of arguments it takes
+type function struct {
+	minArgs int
+	maxArgs int // negative for any number of arguments
+	call    func(args []float64) (float64, error)
+	// angleArgs marks trigonometric functions whose arguments are angles,
+	// converted to radians before the call
+	angleArgs bool
+	// angleResult marks inverse trigonometric functions whose result is an
+	// angle, converted from radians after the call
+	angleResult bool
+	// impure marks functions such as random whose result differs between
+	// calls with the same arguments
+	impure bool
+}
+
+// trig adapts a trigonometric function of an angle
+func trig(f func(float64) float64) function {
+	fn := unary(func(x float64) (float64, error) { return f(x), nil })
+	fn.angleArgs = true
+	return fn
+}
+
+// inverseTrig adapts an inverse trigonometric function, whose result is an
+// angle
+func inverseTrig(f func(float64) (float64, error)) function {
+	fn := unary(f)
+	fn.angleResult = true
+	return fn
+}
+
+// unitDomain rejects arguments outside [-1, 1], the domain of asin and acos
+func unitDomain(name string, f func(float64) float64) func(float64) (float64, error) {
+	return func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, fmt.Errorf("%s requires an argument between -1 and 1", name)
+		}
+		return f(x), nil
+	}
+}
+
+// unary adapts a single argument function
+func unary(f func(float64) (float64, error)) function {
+	return function{minArgs: 1, maxArgs: 1, call: func(args []float64) (float64, error) { return f(args[0]) }}
+}
+
+// fold adapts a binary function to any number of arguments, combining them
+// from the left
+func fold(f func(float64, float64) float64) function {
+	return function{minArgs: 1, maxArgs: -1, call: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = f(result, arg)
+		}
+		return result, nil
+	}}
+}
+
+// integers adapts a binary function of integers, rejecting fractional
+// arguments
+func integers(name string, f func(int64, int64) (int64, error)) function {
+	return function{minArgs: 2, maxArgs: 2, call: func(args []float64) (float64, error) {
+		a, err := toInt64(name, args[0])
+		if err != nil {
+			return 0, err
+		}
+		b, err := toInt64(name, args[1])
+		if err != nil {
+			return 0, err
+		}
+		result, err := f(a, b)
+		return float64(result), err
+	}}
+}
+
+// gcd returns the greatest common divisor of a and b by Euclid's algorithm,
+// which is never negative
+func gcd(a, b int64) int64 {
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// lcm returns the least common multiple of a and b, which is 0 if either is
+func lcm(a, b int64) (int64, error) {
+	if a == 0 || b == 0 {
+		return 0, nil
+	}
+
+	// Divide first so only a result too large for int64 overflows
+	q := a / gcd(a, b)
+	if q < 0 {
+		q = -q
+	}
+	if b < 0 {
+		b = -b
+	}
+	if q > math.MaxInt64/b {
+		return 0, errors.New("lcm overflow")
+	}
+	return q * b, nil
+}
+
+// round rounds x half away from zero, to a whole number or to the number of
+// decimal places given as the second argument
+func round(args []float64) (float64, error) {
+	if len(args) == 1 {
+		return math.Round(args[0]), nil
+	}
+
+	places := args[1]
+	if places != math.Trunc(places) || places < 0 || places > MaxPrecision {
+		return 0, fmt.Errorf("round places must be a whole number between 0 and %d", MaxPrecision)
+	}
+	return RoundFloat(args[0], uint(places), RoundHalfAwayFromZero), nil
+}
+
+// logarithm returns the base 10 logarithm of x, or the logarithm to the
+// base given as the second argument
+func logarithm(args []float64) (float64, error) {
+	x := args[0]
+	if x <= 0 {
+		return 0, errors.New("logarithm of a non-positive number")
+	}
+	if len(args) == 1 {
+		return math.Log10(x), nil
+	}
+
+	// Bases 2 and 10 have exact functions, others change base through ln
+	switch base := args[1]; {
+	case base <= 0 || base == 1:
+		return 0, errors.New("logarithm base must be positive and not 1")
+	case base == 2:
+		return math.Log2(x), nil
+	case base == 10:
+		return math.Log10(x), nil
+	default:
+		return math.Log(x) / math.Log(base), nil
+	}
+}
+
+// source generates the values of random and rand. It is shared by every
+// calculation, so it is guarded by sourceMu.
+var (
+	sourceMu sync.Mutex
+	source   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// Seed reseeds the generator behind random and rand, so the values they
+// return are reproducible
+func Seed(seed int64) {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	source.Seed(seed)
+}
+
+// randomFloat returns a value in [0, 1) from source
+func randomFloat() float64 {
+	sourceMu.Lock()
+	defer sourceMu.Unlock()
+
+	return source.Float64()
+}
+
+// randomBetween returns a value in [a, b)
+func randomBetween(args []float64) (float64, error) {
+	a, b := args[0], args[1]
+	if !(a < b) {
+		return 0, errors.New("rand requires a < b")
+	}
+
+	// Rounding can reach b itself when the range is tiny relative to a
+	result := a + randomFloat()*(b-a)
+	if result >= b {
+		result = math.Nextafter(b, a)
+	}
+	return result, nil
+}
+
+// functions maps the supported function names to their implementations
+var functions = map[string]function{
+	"sqrt": unary(func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, errors.New("square root of a negative number")
+		}
+		return math.Sqrt(x), nil
+	}),
+	"ln": unary(func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, errors.New("logarithm of a non-positive number")
+		}
+		return math.Log(x), nil
+	}),
+	"log":  {minArgs: 1, maxArgs: 2, call: logarithm},
+	"sin":  trig(math.Sin),
+	"cos":  trig(math.Cos),
+	"tan":  trig(math.Tan),
+	"asin": inverseTrig(unitDomain("asin", math.Asin)),
+	"acos": inverseTrig(unitDomain("acos", math.Acos)),
+	"atan": inverseTrig(func(x float64) (float64, error) { return math.Atan(x), nil }),
+	"atan2": {minArgs: 2, maxArgs: 2, angleResult: true, call: func(args []float64) (float64, error) {
+		return math.Atan2(args[0], args[1]), nil
+	}},
+	"sinh":  unary(func(x float64) (float64, error) { return math.Sinh(x), nil }),
+	"cosh":  unary(func(x float64) (float64, error) { return math.Cosh(x), nil }),
+	"tanh":  unary(func(x float64) (float64, error) { return math.Tanh(x), nil }),
+	"abs":   unary(func(x float64) (float64, error) { return math.Abs(x), nil }),
+	"floor": unary(func(x float64) (float64, error) { return math.Floor(x), nil }),
+	"ceil":  unary(func(x float64) (float64, error) { return math.Ceil(x), nil }),
+	"round": {minArgs: 1, maxArgs: 2, call: round},
+	"min":   fold(math.Min),
+	"max":   fold(math.Max),
+	"pow": {minArgs: 2, maxArgs: 2, call: func(args []float64) (float64, error) {
+		return power(args[0], args[1])
+	}},
+	"xor": integers("xor", func(a, b int64) (int64, error) { return a ^ b, nil }),
+	"gcd": integers("gcd", func(a, b int64) (int64, error) { return gcd(a, b), nil }),
+	"lcm": integers("lcm", lcm),
+	"random": {impure: true, call: func([]float64) (float64, error) {
+		return randomFloat(), nil
+	}},
+	"rand": {minArgs: 2, maxArgs: 2, impure: true, call: randomBetween},
+	"nCr":  {minArgs: 2, maxArgs: 2, call: combinatoric("nCr", true)},
+	"nPr":  {minArgs: 2, maxArgs: 2, call: combinatoric("nPr", false)},
+}
+
+// isFunction reports whether the token names a supported function
+func isFunction(token string) bool {
+	_, exists := functions[token]
+	return exists
+}
+
+// IsDeterministic reports whether the expression always gives the same
+// result, which it doesn't when it calls an impure function such as random
+func IsDeterministic(Expr string) bool {
+	for _, name := range strings.FieldsFunc(Expr, func(ch rune) bool { return !unicode.IsLetter(ch) }) {
+		if functions[name].impure {
+			return false
+		}
+	}
+	return true
+}
+
+// checkArity reports whether the named function accepts count arguments
+func checkArity(name string, count int) error {
+	f := functions[name]
+
+	switch {
+	case f.minArgs == f.maxArgs && count != f.minArgs:
+		return fmt.Errorf("%s expects %s, got %d", name, plural(f.minArgs, "argument"), count)
+	case count < f.minArgs:
+		return fmt.Errorf("%s expects at least %s, got %d", name, plural(f.minArgs, "argument"), count)
+	case f.maxArgs >= 0 && count > f.maxArgs:
+		return fmt.Errorf("%s expects at most %s, got %d", name, plural(f.maxArgs, "argument"), count)
+	}
+	return nil
+}
+
+// plural formats a count of things
+func plural(count int, noun string) string {
+	if count == 1 {
+		return fmt.Sprintf("%d %s", count, noun)
+	}
+	return fmt.Sprintf("%d %ss", count, noun)
+}
+
+// checkDegrees rejects tan of an odd multiple of 90°, which converts to
+// just off the pole in radians and would give a huge finite number rather
+// than no result at all
+func checkDegrees(name string, arg float64) error {
+	if name == "tan" && math.Mod(math.Abs(arg), 180) == 90 {
+		return fmt.Errorf("tan is undefined at %s°", FormatFloat(arg, DefaultPrecision, RoundHalfAwayFromZero))
+	}
+	return nil
+}
+
+// callFunction applies the named function, with angles in the given unit
+func callFunction(name string, args []float64, angle AngleMode) (float64, error) {
+	if err := checkArity(name, len(args)); err != nil {
+		return 0, err
+	}
+
+	f := functions[name]
+
+	if f.angleArgs && angle == Degrees {
+		if err := checkDegrees(name, args[0]); err != nil {
+			return 0, err
+		}
+		converted := make([]float64, len(args))
+		for i, arg := range args {
+			converted[i] = arg * math.Pi / 180
+		}
+		args = converted
+	}
+
+	result, err := f.call(args)
+	if err != nil {
+		return 0, err
+	}
+
+	if f.angleResult && angle == Degrees {
+		result = result * 180 / math.Pi
+	}
+
+	return result, nil
+}
+
+// power raises base to exponent, reporting results too large for a float64
+// rather than returning Inf
+func power(base, exponent float64) (float64, error) {
+	if base == 0 && exponent < 0 {
+		return 0, errors.New("division by zero")
+	}
+
+	result := math.Pow(base, exponent)
+	if math.IsInf(result, 0) && !math.IsInf(base, 0) && !math.IsInf(exponent, 0) {
+		return 0, errors.New("exponentiation overflow, the result is too large for a float64")
+	}
+	return result, nil
+}
+
+// maxFactorial is the largest n for which n! fits in a float64
+const maxFactorial = 170
+
+// factorial computes n! exactly with integer math and returns the nearest
+// float64. Negative, fractional and overflowing operands are errors.
+func factorial(n float64) (float64, error) {
+	if n < 0 || n != math.Trunc(n) {
+		return 0, errors.New("factorial requires a non-negative integer")
+	}
+	if n > maxFactorial {
+		return 0, fmt.Errorf("factorial overflow, %d! is the largest that fits in a float64", maxFactorial)
+	}
+
+	result, _ := new(big.Float).SetInt(new(big.Int).MulRange(1, int64(n))).Float64()
+	return result, nil
+}
+
+// combinatoric returns nCr, the number of ways to choose r of n things, or
+// nPr, the number of ways to arrange them, when choose is false. The
+// product is built one factor at a time rather than from factorials, so it
+// only overflows if the result itself is too large for a float64, and it is
+// exact while the result is below 2^53.
+func combinatoric(name string, choose bool) func(args []float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		n, r := args[0], args[1]
+		switch {
+		case n < 0 || r < 0 || n != math.Trunc(n) || r != math.Trunc(r):
+			return 0, fmt.Errorf("%s requires non-negative integers", name)
+		case r > n:
+			return 0, fmt.Errorf("%s requires r <= n, got %s(%g, %g)", name, name, n, r)
+		}
+
+		// Choosing r is choosing the n - r left out, which takes fewer steps
+		if choose && n-r < r {
+			r = n - r
+		}
+
+		// After step i the result is nCr or nPr of n - r + i and i, so i
+		// divides the product. Cancelling their common factor first keeps
+		// the product exact whenever the next result is.
+		result := 1.0
+		for i := 1.0; i <= r; i++ {
+			factor := n - r + i
+			switch {
+			case !choose:
+				result *= factor
+			case result < 1<<53:
+				common := float64(gcd(int64(result), int64(i)))
+				result = result / common * (factor / (i / common))
+			default:
+				result = result / i * factor
+			}
+			if math.IsInf(result, 0) {
+				return 0, fmt.Errorf("%s overflow, the result is too large for a float64", name)
+			}
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,156 @@
+package calc
+
+import "testing"
+
+func TestAngleModes(t *testing.T) {
+	deg := DefaultOptions()
+	deg.Angle = Degrees
+	checkCases(t, deg, []calcCase{
+		{expr: "sin(90)", want: "1"},
+		{expr: "cos(180)", want: "-1"},
+		{expr: "tan(45)", want: "1"},
+		{expr: "tan(-45)", want: "-1"},
+		{expr: "asin(1)", want: "90"},
+		{expr: "atan2(1, 1)", want: "45"},
+		{expr: "tan(90)", err: "tan is undefined at 90°"},
+		{expr: "tan(-90)", err: "tan is undefined at -90°"},
+		{expr: "tan(270)", err: "tan is undefined at 270°"},
+		{expr: "tan(180)", want: "0"},
+	})
+
+	rad := DefaultOptions()
+	checkCases(t, rad, []calcCase{
+		{expr: "sin(90)", want: "0.894"},
+		{expr: "asin(1)", want: "1.5708"},
+		{expr: "tan(0)", want: "0"},
+	})
+
+	cplx := deg
+	cplx.Complex = true
+	checkCases(t, cplx, []calcCase{
+		{expr: "sin(90)", want: "1"},
+		{expr: "tan(90)", err: "tan is undefined at 90°"},
+	})
+}
+
+func TestMultiArgumentFunctions(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "max(3, 7, 2)", want: "7"},
+		{expr: "min(1, 5)", want: "1"},
+		{expr: "max(4)", want: "4"},
+		{expr: "pow(2, 10)", want: "1024"},
+		{expr: "pow(2, -1)", want: "0.5"},
+		{expr: "max(-1, -2)", want: "-1"},
+		{expr: "max(1, min(4, 2))", want: "2"},
+		{expr: "min(max(1, 2), max(3, 4))", want: "2"},
+		{expr: "max(1,2)+min(3,4)", want: "5"},
+		{expr: "pow(2)", err: "pow expects 2 arguments, got 1 at position 1"},
+		{expr: "pow(1,2,3)", err: "pow expects 2 arguments, got 3 at position 1"},
+		{expr: "max()", err: "max expects at least 1 argument, got 0 at position 1"},
+		{expr: "min()", err: "min expects at least 1 argument, got 0 at position 1"},
+		{expr: "1, 2", err: "comma outside of a function call at position 2"},
+		{expr: "(1, 2)", err: "comma outside of a function call at position 3"},
+		{expr: "max((1,2))", err: "comma outside of a function call at position 7"},
+	})
+}
+
+func TestArity(t *testing.T) {
+	bare := "function sin must be called with parentheses, eg. sin(2)"
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "sin(1, 2)", err: "sin expects 1 argument, got 2 at position 1"},
+		{expr: "sin()", err: "sin expects 1 argument, got 0 at position 1"},
+		{expr: "sin", err: bare + " at position 1"},
+		{expr: "sin + 1", err: bare + " at position 1"},
+		{expr: "2*sin", err: bare + " at position 3"},
+		{expr: "sin(cos(tan(0)))", want: "0.8415"},
+		{expr: "sqrt(sqrt(sqrt(sin(1, 2))))", err: "sin expects 1 argument, got 2 at position 16"},
+		{expr: "max(min(1, pow(2)), 3)", err: "pow expects 2 arguments, got 1 at position 12"},
+		{expr: "1 + max(1, min(2, 3, abs(4, 5)))", err: "abs expects 1 argument, got 2 at position 22"},
+		{expr: "pow(pow(2, 3), pow(2))", err: "pow expects 2 arguments, got 1 at position 16"},
+	})
+}
+
+func TestLogarithms(t *testing.T) {
+	nonPositive := "logarithm of a non-positive number"
+	badBase := "logarithm base must be positive and not 1"
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "log(1000)", want: "3"},
+		{expr: "log(100)", want: "2"},
+		{expr: "log(8, 2)", want: "3"},
+		{expr: "log(27, 3)", want: "3"},
+		{expr: "log(1, 2)", want: "0"},
+		{expr: "log(0.5, 0.5)", want: "1"},
+		{expr: "ln(e)", want: "1"},
+		{expr: "log(-1)", err: nonPositive},
+		{expr: "log(0)", err: nonPositive},
+		{expr: "log(-8, 2)", err: nonPositive},
+		{expr: "ln(0)", err: nonPositive},
+		{expr: "ln(-1)", err: nonPositive},
+		{expr: "log(8, 1)", err: badBase},
+		{expr: "log(8, 0)", err: badBase},
+		{expr: "log(8, -2)", err: badBase},
+		{expr: "log()", err: "log expects at least 1 argument, got 0 at position 1"},
+		{expr: "log(8, 2, 1)", err: "log expects at most 2 arguments, got 3 at position 1"},
+	})
+}
+
+func TestInverseAndHyperbolicFunctions(t *testing.T) {
+	cases := []calcCase{
+		{expr: "asin(2)", err: "asin requires an argument between -1 and 1"},
+		{expr: "asin(-1.0001)", err: "asin requires an argument between -1 and 1"},
+		{expr: "acos(1.0001)", err: "acos requires an argument between -1 and 1"},
+		{expr: "atan2(1)", err: "atan2 expects 2 arguments, got 1 at position 1"},
+		{expr: "sinh(1)", want: "1.1752"},
+		{expr: "cosh(0)", want: "1"},
+		{expr: "tanh(100)", want: "1"},
+		{expr: "atan2(0, 0)", want: "0"},
+	}
+	checkCases(t, DefaultOptions(), append(cases, []calcCase{
+		{expr: "asin(1)", want: "1.5708"},
+		{expr: "asin(-1)", want: "-1.5708"},
+		{expr: "acos(-1)", want: "3.1416"},
+		{expr: "atan(1)", want: "0.7854"},
+		{expr: "atan2(1, -1)", want: "2.3562"},
+	}...))
+
+	deg := DefaultOptions()
+	deg.Angle = Degrees
+	checkCases(t, deg, append(cases, []calcCase{
+		{expr: "asin(1)", want: "90"},
+		{expr: "asin(-1)", want: "-90"},
+		{expr: "acos(-1)", want: "180"},
+		{expr: "atan(1)", want: "45"},
+		{expr: "atan2(1, -1)", want: "135"},
+	}...))
+}
+
+func TestCombinatorics(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "nCr(5, 2)", want: "10"},
+		{expr: "nPr(5, 2)", want: "20"},
+		{expr: "nCr(0, 0)", want: "1"},
+		{expr: "nCr(100, 0)", want: "1"},
+		{expr: "nPr(5, 0)", want: "1"},
+		{expr: "nCr(100, 50) > 1.0089e29", want: "1"},
+		{expr: "nPr(10, 10) == 10!", want: "1"},
+		{expr: "nPr(170, 170) > 7.25e306", want: "1"},
+		{expr: "nCr(5, 6)", err: "nCr requires r <= n, got nCr(5, 6)"},
+		{expr: "nCr(-1, 0)", err: "nCr requires non-negative integers"},
+		{expr: "nCr(5.5, 2)", err: "nCr requires non-negative integers"},
+		{expr: "nCr(1030, 515)", err: "nCr overflow, the result is too large for a float64"},
+		{expr: "nPr(171, 171)", err: "nPr overflow, the result is too large for a float64"},
+		{expr: "nCr(5)", err: "nCr expects 2 arguments, got 1 at position 1"},
+	})
+}
+
+func TestCombinationsSymmetry(t *testing.T) {
+	for _, n := range []float64{0, 1, 5, 20, 52, 100} {
+		for r := 0.0; r <= n; r++ {
+			a, errA := callFunction("nCr", []float64{n, r}, Radians)
+			b, errB := callFunction("nCr", []float64{n, n - r}, Radians)
+			if errA != nil || errB != nil || a != b {
+				t.Errorf("nCr(%v, %v) = %v (%v), nCr(%v, %v) = %v (%v)", n, r, a, errA, n, n-r, b, errB)
+			}
+		}
+	}
+}
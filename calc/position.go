@@ -0,0 +1,87 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ExprError is an error at a character in the expression, so the problem
+// can be pointed at. Positions count characters from 1.
+type ExprError struct {
+	Pos int
+	Msg string
+	// Err is the sentinel error reported, if any, such as ErrUnbalancedParens
+	Err error
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+func (e *ExprError) Unwrap() error {
+	return e.Err
+}
+
+// errorAt reports err at the given position
+func errorAt(pos int, err error) *ExprError {
+	return &ExprError{Pos: pos, Msg: err.Error(), Err: err}
+}
+
+// ErrorPosition returns the position of the character err refers to, or 0
+// if it doesn't refer to one
+func ErrorPosition(err error) int {
+	var exprErr *ExprError
+	if errors.As(err, &exprErr) {
+		return exprErr.Pos
+	}
+	return 0
+}
+
+// shiftPosition moves the position of err, if it has one, by offset
+// characters, for an error found in a part of the input
+func shiftPosition(err error, offset int) error {
+	var exprErr *ExprError
+	if errors.As(err, &exprErr) {
+		exprErr.Pos += offset
+	}
+	return err
+}
+
+// InOriginal translates the position of err, if it has one, from the
+// preprocessed expression back to the original input
+func InOriginal(err error, original, processed string, opts Options) error {
+	var exprErr *ExprError
+	if errors.As(err, &exprErr) {
+		exprErr.Pos = originalPosition(original, processed, exprErr.Pos, opts.Aliases)
+	}
+	return err
+}
+
+// originalPosition maps a position in the preprocessed expression to the
+// original input. Preprocessing only drops characters, such as spaces, or
+// replaces one with another, such as the separators of a decimal comma or
+// × or an alias for its operator, so the two are aligned by skipping the
+// original characters that don't match. A position just past the end maps
+// to just past the last character kept.
+func originalPosition(original, processed string, pos int, aliases map[rune]rune) int {
+	kept := []rune(processed)
+	matched, last := 0, 0
+	for i, ch := range []rune(original) {
+		if matched == len(kept) {
+			break
+		}
+
+		want := kept[matched]
+		replaced := unicodeSymbols[ch] == want || aliases[ch] == want || want == ',' && ch == ';' || want == '.' && ch == ','
+		if ch != want && !replaced {
+			continue
+		}
+
+		matched++
+		last = i + 1
+		if matched == pos {
+			return last
+		}
+	}
+	return last + 1
+}
@@ -0,0 +1,362 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Preprocessor is a single normalization step applied to the raw input
+// before it is validated and tokenized
+type Preprocessor func(string) (string, error)
+
+// DefaultPreprocessors is the ordered chain applied to every expression
+var DefaultPreprocessors = []Preprocessor{
+	UnicodeSymbols,
+	SeparatedNumbers,
+	SeparatedOperators,
+	SeparatedNames,
+	StripSpaces,
+	LeadingEquals,
+}
+
+// PreprocessorsFor returns the chain for the given options
+func PreprocessorsFor(opts Options) []Preprocessor {
+	steps := append([]Preprocessor{}, DefaultPreprocessors...)
+	if len(opts.Aliases) > 0 {
+		steps = append(steps, OperatorAliases(opts.Aliases))
+	}
+	steps = append(steps, TrailingSeparator(opts.LenientSeparators))
+	if opts.DecimalComma {
+		steps = append(steps, DecimalComma)
+	}
+	return steps
+}
+
+// Preprocess runs the expression through each step in order,
+// stopping at the first step that reports an error. Error positions are in
+// expr as given, not in the text the step was given.
+func Preprocess(expr string, steps []Preprocessor) (string, error) {
+	inputs := make([]string, 0, len(steps))
+	for _, step := range steps {
+		inputs = append(inputs, expr)
+		var err error
+		if expr, err = step(expr); err != nil {
+			return "", inFirstInput(err, inputs)
+		}
+	}
+
+	return expr, nil
+}
+
+// inFirstInput translates the position of err, if it has one, from the last
+// of the inputs to the steps back to the first. A step either keeps the
+// length, replacing characters one for one, or drops some, so only the
+// steps that drop characters move positions.
+func inFirstInput(err error, inputs []string) error {
+	var exprErr *ExprError
+	if !errors.As(err, &exprErr) {
+		return err
+	}
+
+	for i := len(inputs) - 1; i > 0; i-- {
+		if before, after := inputs[i-1], inputs[i]; utf8.RuneCountInString(before) != utf8.RuneCountInString(after) {
+			exprErr.Pos = originalPosition(before, after, exprErr.Pos, nil)
+		}
+	}
+	return err
+}
+
+// unicodeSymbols maps the Unicode lookalikes of operators and parentheses
+// often pasted from documents to their ASCII form
+var unicodeSymbols = map[rune]rune{
+	'×':      '*', // multiplication sign
+	'·':      '*', // middle dot
+	'⋅':      '*', // dot operator
+	'÷':      '/', // division sign
+	'∕':      '/', // division slash
+	'−':      '-', // minus sign
+	'–':      '-', // en dash
+	'（':      '(', // fullwidth parentheses
+	'）':      ')',
+	'\u00a0': ' ', // no-break space
+}
+
+// UnicodeSymbols replaces Unicode operator symbols, such as × and −, with
+// their ASCII equivalents. Other characters are left for validation to
+// reject.
+func UnicodeSymbols(expr string) (string, error) {
+	return strings.Map(func(ch rune) rune {
+		if ascii, ok := unicodeSymbols[ch]; ok {
+			return ascii
+		}
+		return ch
+	}, expr), nil
+}
+
+// aliasOperators are the operators a character may be an alias for
+const aliasOperators = "+-*/%^&|<>!"
+
+// CheckAliases reports whether each alias may stand for its operator. The
+// operator must be one of + - * / % ^ & | < > !, and the alias a symbol
+// with no meaning of its own: letters would clash with names such as max
+// and literals such as 0x1F, and digits, spaces and the characters already
+// read, such as ( and ×, keep their meaning.
+func CheckAliases(aliases map[rune]rune) error {
+	for alias, op := range aliases {
+		switch {
+		case !strings.ContainsRune(aliasOperators, op):
+			return fmt.Errorf("alias %q must stand for one of %s", alias, aliasOperators)
+		case unicode.IsLetter(alias) || unicode.IsDigit(alias) || unicode.IsSpace(alias):
+			return fmt.Errorf("alias %q can't be a letter, digit or space", alias)
+		case allowedCharacters.MatchString(string(alias)) || strings.ContainsRune(";", alias) || unicodeSymbols[alias] != 0:
+			return fmt.Errorf("alias %q already has a meaning", alias)
+		}
+	}
+	return nil
+}
+
+// OperatorAliases returns a step replacing each alias with its operator,
+// as checked by CheckAliases
+func OperatorAliases(aliases map[rune]rune) Preprocessor {
+	return func(expr string) (string, error) {
+		return strings.Map(func(ch rune) rune {
+			if op, ok := aliases[ch]; ok {
+				return op
+			}
+			return ch
+		}, expr), nil
+	}
+}
+
+// StripSpaces removes all spaces from the expression
+func StripSpaces(expr string) (string, error) {
+	return strings.ReplaceAll(expr, " ", ""), nil
+}
+
+// LeadingEquals drops a single leading '=', as typed into spreadsheets, so
+// =1+2 is 1+2. Any other '=' is left for the tokenizer to reject.
+func LeadingEquals(expr string) (string, error) {
+	return strings.TrimPrefix(expr, "="), nil
+}
+
+// Errors reported for numbers separated only by spaces
+var (
+	ErrMissingOperator = errors.New("missing operator between numbers")
+	ErrSpaceInNumber   = errors.New("unexpected space within number")
+)
+
+// SeparatedNumbers rejects numbers separated only by spaces, such as 2 3,
+// which stripping the spaces would otherwise glue together into 23. Spaces
+// don't group digits either, so 1 000 is rejected as a space within a
+// number rather than read as 1000, and 2e - 1 as one rather than read as
+// 2e-1.
+func SeparatedNumbers(expr string) (string, error) {
+	for i := 0; i < len(expr); i++ {
+		if !isDigit(expr[i]) && expr[i] != '.' {
+			continue
+		}
+
+		// An e after a hex digit is another digit, not an exponent
+		if !inHexLiteral(expr[:i+1]) && isSpacedExponent(expr[i+1:]) {
+			space := i + 1 + strings.IndexFunc(expr[i+1:], unicode.IsSpace)
+			return "", errorAt(utf8.RuneCountInString(expr[:space])+1, ErrSpaceInNumber)
+		}
+
+		// Skip the spaces after the digit and look at what follows
+		rest := strings.TrimLeftFunc(expr[i+1:], unicode.IsSpace)
+		if len(rest) == len(expr[i+1:]) || rest == "" || !(isDigit(rest[0]) || rest[0] == '.') {
+			continue
+		}
+
+		err := ErrMissingOperator
+		if isDigitGroup(expr[:i+1], rest) {
+			err = ErrSpaceInNumber
+		}
+		return "", errorAt(utf8.RuneCountInString(expr[:i+1])+1, err)
+	}
+
+	return expr, nil
+}
+
+// isSpacedExponent reports whether after, following a digit, is an exponent
+// with spaces around its e or sign, as in 2e - 1 or 2 e5
+func isSpacedExponent(after string) bool {
+	rest := strings.TrimLeftFunc(after, unicode.IsSpace)
+	if rest == "" || rest[0] != 'e' && rest[0] != 'E' {
+		return false
+	}
+	spaced := len(rest) != len(after)
+
+	exponent := strings.TrimLeftFunc(rest[1:], unicode.IsSpace)
+	spaced = spaced || len(exponent) != len(rest)-1
+	if exponent != "" && (exponent[0] == '+' || exponent[0] == '-') {
+		digits := strings.TrimLeftFunc(exponent[1:], unicode.IsSpace)
+		spaced = spaced || len(digits) != len(exponent)-1
+		exponent = digits
+	}
+
+	return spaced && exponent != "" && (isDigit(exponent[0]) || exponent[0] == '.')
+}
+
+// inHexLiteral reports whether before ends within a hex literal such as 0x1e
+func inHexLiteral(before string) bool {
+	start := len(before)
+	for start > 0 && (isDigit(before[start-1]) || unicode.IsLetter(rune(before[start-1]))) {
+		start--
+	}
+	literal := before[start:]
+	return len(literal) > 1 && literal[0] == '0' && (literal[1] == 'x' || literal[1] == 'X')
+}
+
+// isDigitGroup reports whether a space between before and after looks like
+// it groups thousands, as in 1 000: a whole number of at most three digits
+// followed by exactly three
+func isDigitGroup(before, after string) bool {
+	start := len(before)
+	for start > 0 && isDigit(before[start-1]) {
+		start--
+	}
+	if n := len(before) - start; n == 0 || n > 3 || start > 0 && before[start-1] == '.' {
+		return false
+	}
+
+	end := 0
+	for end < len(after) && isDigit(after[end]) {
+		end++
+	}
+	return end == 3
+}
+
+// ErrSpaceInOperator is reported for a two-character operator split by
+// spaces
+var ErrSpaceInOperator = errors.New("unexpected space within operator")
+
+// splitOperators are the two-character operators whose halves are operators
+// of their own, so a space between them changes the meaning
+var splitOperators = map[string]bool{"**": true, "//": true, "<<": true, ">>": true}
+
+// SeparatedOperators rejects an operator such as ** split by spaces, as in
+// 2 * * 3, which stripping the spaces would otherwise read as 2 ** 3
+func SeparatedOperators(expr string) (string, error) {
+	for i := 0; i < len(expr); i++ {
+		rest := strings.TrimLeftFunc(expr[i+1:], unicode.IsSpace)
+		if len(rest) == len(expr[i+1:]) || rest == "" || !splitOperators[expr[i:i+1]+rest[:1]] {
+			continue
+		}
+		return "", errorAt(utf8.RuneCountInString(expr[:i+1])+1, ErrSpaceInOperator)
+	}
+
+	return expr, nil
+}
+
+// ErrSpaceInName is reported for a name split by spaces
+var ErrSpaceInName = errors.New("unexpected space within name")
+
+// SeparatedNames rejects a name split by spaces, as in sin 1 or a b, and a
+// hex literal, as in 0xA B, which stripping the spaces would otherwise glue
+// together into sin1, ab and 0xAB. A space after a number, as in 2 x, only
+// separates the factors of an implicit multiplication.
+func SeparatedNames(expr string) (string, error) {
+	for i := 0; i < len(expr); i++ {
+		rest := strings.TrimLeftFunc(expr[i+1:], unicode.IsSpace)
+		if len(rest) == len(expr[i+1:]) || rest == "" {
+			continue
+		}
+
+		before, _ := utf8.DecodeLastRuneInString(expr[:i+1])
+		after, _ := utf8.DecodeRuneInString(rest)
+		switch {
+		case inHexLiteral(expr[:i+1]) && isHexDigit(after):
+			return "", errorAt(utf8.RuneCountInString(expr[:i+1])+1, ErrSpaceInNumber)
+		case unicode.IsLetter(before) && (unicode.IsLetter(after) || unicode.IsDigit(after)):
+			return "", errorAt(utf8.RuneCountInString(expr[:i+1])+1, ErrSpaceInName)
+		}
+	}
+
+	return expr, nil
+}
+
+// isHexDigit reports whether ch is a digit of a hex literal
+func isHexDigit(ch rune) bool {
+	return strings.ContainsRune("0123456789abcdefABCDEF", ch)
+}
+
+// ErrMisplacedGroupSeparator is reported for a '.' that doesn't separate
+// groups of three digits when the decimal comma is used
+var ErrMisplacedGroupSeparator = errors.New("misplaced digit group separator")
+
+// DecimalComma rewrites an expression written with a decimal comma, such as
+// max(1.234,5; 2), to the usual form max(1234.5, 2). A '.' must separate
+// groups of three digits.
+func DecimalComma(expr string) (string, error) {
+	var converted strings.Builder
+	for i := 0; i < len(expr); i++ {
+		switch ch := expr[i]; ch {
+		case '.':
+			if !isGroupSeparator(expr, i) {
+				return "", errorAt(utf8.RuneCountInString(expr[:i])+1, ErrMisplacedGroupSeparator)
+			}
+		case ',':
+			converted.WriteByte('.')
+		case ';':
+			converted.WriteByte(',')
+		default:
+			converted.WriteByte(ch)
+		}
+	}
+
+	return converted.String(), nil
+}
+
+// isGroupSeparator reports whether the '.' at i follows a digit and is
+// followed by exactly three digits
+func isGroupSeparator(expr string, i int) bool {
+	if i == 0 || i+4 > len(expr) || !isDigit(expr[i-1]) {
+		return false
+	}
+	for _, ch := range []byte(expr[i+1 : i+4]) {
+		if !isDigit(ch) {
+			return false
+		}
+	}
+	return i+4 == len(expr) || !isDigit(expr[i+4])
+}
+
+// isDigit reports whether ch is an ASCII digit
+func isDigit(ch byte) bool {
+	return '0' <= ch && ch <= '9'
+}
+
+// errTrailingSeparator reports a trailing separator that isn't ignored
+func errTrailingSeparator(sep rune) error {
+	return fmt.Errorf("trailing separator %q is not allowed", string(sep))
+}
+
+// TrailingSeparator returns a step handling a ';' or ',' ending the
+// expression or an argument list, as in 1, or max(1, 2,), which is
+// ambiguous once statements and argument lists are involved. When lenient a
+// single trailing separator is dropped, otherwise it is rejected. Spaces
+// must have been stripped already.
+func TrailingSeparator(lenient bool) Preprocessor {
+	return func(expr string) (string, error) {
+		var b strings.Builder
+		for i := 0; i < len(expr); i++ {
+			ch := expr[i]
+			isSep := ch == ',' || ch == ';'
+			ends := i+1 == len(expr) || expr[i+1] == ')'
+			if !isSep || !ends || i > 0 && expr[i-1] == '(' {
+				b.WriteByte(ch)
+				continue
+			}
+
+			// Only one is dropped, so 1,, and max(1,,) are still rejected
+			if !lenient || i > 0 && (expr[i-1] == ',' || expr[i-1] == ';') {
+				return "", errTrailingSeparator(rune(ch))
+			}
+		}
+		return b.String(), nil
+	}
+}
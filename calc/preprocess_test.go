@@ -0,0 +1,247 @@
+package calc
+
+import "testing"
+
+// preprocessCase is an input to a preprocessor step and the text it gives,
+// or the error when err is set
+type preprocessCase struct {
+	in   string
+	want string
+	err  string
+}
+
+// checkPreprocessor runs each case through steps and compares the outcome
+func checkPreprocessor(t *testing.T, name string, steps []Preprocessor, cases []preprocessCase) {
+	t.Helper()
+	for _, tc := range cases {
+		got, err := Preprocess(tc.in, steps)
+		switch {
+		case tc.err != "" && err == nil:
+			t.Errorf("%s(%q) = %q, want error %q", name, tc.in, got, tc.err)
+		case tc.err != "" && err.Error() != tc.err:
+			t.Errorf("%s(%q): error %q, want %q", name, tc.in, err, tc.err)
+		case tc.err == "" && err != nil:
+			t.Errorf("%s(%q): unexpected error %q", name, tc.in, err)
+		case tc.err == "" && got != tc.want:
+			t.Errorf("%s(%q) = %q, want %q", name, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestPreprocessorSteps(t *testing.T) {
+	tests := []struct {
+		name  string
+		step  Preprocessor
+		cases []preprocessCase
+	}{
+		{name: "UnicodeSymbols", step: UnicodeSymbols, cases: []preprocessCase{
+			{in: "6 × 7 − 2", want: "6 * 7 - 2"},
+			{in: "8 ÷ 2·3", want: "8 / 2*3"},
+			{in: "（1+2）\u00a0", want: "(1+2) "},
+			{in: "1 + é", want: "1 + é"},
+		}},
+		{name: "SeparatedNumbers", step: SeparatedNumbers, cases: []preprocessCase{
+			{in: "2 + 3", want: "2 + 3"},
+			{in: "2 3", err: "missing operator between numbers at position 2"},
+			{in: "1 000", err: "unexpected space within number at position 2"},
+			{in: "1.5 000", err: "missing operator between numbers at position 4"},
+			{in: "x 2", want: "x 2"},
+		}},
+		{name: "SeparatedOperators", step: SeparatedOperators, cases: []preprocessCase{
+			{in: "2 ** 3", want: "2 ** 3"},
+			{in: "2 * -3", want: "2 * -3"},
+			{in: "2 * * 3", err: "unexpected space within operator at position 4"},
+			{in: "7 / / 2", err: "unexpected space within operator at position 4"},
+			{in: "1 <  < 2", err: "unexpected space within operator at position 4"},
+			{in: "2 × × 3", want: "2 × × 3"},
+		}},
+		{name: "SeparatedNames", step: SeparatedNames, cases: []preprocessCase{
+			{in: "sin (1) + a", want: "sin (1) + a"},
+			{in: "2 x", want: "2 x"},
+			{in: "sin 1", err: "unexpected space within name at position 4"},
+			{in: "a b", err: "unexpected space within name at position 2"},
+			{in: "0xA B", err: "unexpected space within number at position 4"},
+		}},
+		{name: "StripSpaces", step: StripSpaces, cases: []preprocessCase{
+			{in: " 1 + 2 ", want: "1+2"},
+			{in: "", want: ""},
+		}},
+		{name: "LeadingEquals", step: LeadingEquals, cases: []preprocessCase{
+			{in: "=1+2", want: "1+2"},
+			{in: "==1", want: "=1"},
+			{in: "x=1", want: "x=1"},
+		}},
+		{name: "OperatorAliases", step: OperatorAliases(map[rune]rune{'@': '*', ':': '/'}), cases: []preprocessCase{
+			{in: "2@3:4", want: "2*3/4"},
+		}},
+		{name: "DecimalComma", step: DecimalComma, cases: []preprocessCase{
+			{in: "1,5+2", want: "1.5+2"},
+			{in: "max(1.234,5;2)", want: "max(1234.5,2)"},
+			{in: "1.5", err: "misplaced digit group separator at position 2"},
+			{in: "1.000.5", err: "misplaced digit group separator at position 6"},
+		}},
+		{name: "TrailingSeparator", step: TrailingSeparator(false), cases: []preprocessCase{
+			{in: "max(1,2)", want: "max(1,2)"},
+			{in: "max(1,2,)", err: `trailing separator "," is not allowed`},
+		}},
+		{name: "TrailingSeparator lenient", step: TrailingSeparator(true), cases: []preprocessCase{
+			{in: "max(1,2,)", want: "max(1,2)"},
+			{in: "1;", want: "1"},
+			{in: "1;;", err: `trailing separator ";" is not allowed`},
+		}},
+	}
+	for _, tc := range tests {
+		checkPreprocessor(t, tc.name, []Preprocessor{tc.step}, tc.cases)
+	}
+}
+
+func TestPreprocessorChain(t *testing.T) {
+	checkPreprocessor(t, "DefaultPreprocessors", DefaultPreprocessors, []preprocessCase{
+		{in: "= 6 × 7 − 2", want: "6*7-2"},
+		{in: " 1 + （2 ÷ 4） ", want: "1+(2/4)"},
+		{in: "2 3", err: "missing operator between numbers at position 2"},
+		{in: "2\u00a03", err: "missing operator between numbers at position 2"},
+		{in: "2 × × 3", err: "unexpected space within operator at position 4"},
+		{in: "sin\t1", err: "unexpected space within name at position 4"},
+	})
+
+	opts := DefaultOptions()
+	opts.DecimalComma = true
+	opts.LenientSeparators = true
+	checkPreprocessor(t, "PreprocessorsFor", PreprocessorsFor(opts), []preprocessCase{
+		{in: "max(1,5; 2;)", want: "max(1.5,2)"},
+		{in: "= 1.000,5 × 2", want: "1000.5*2"},
+		{in: "= 1,5 + 2.5", err: "misplaced digit group separator at position 10"},
+	})
+}
+
+func TestPreprocessorsFor(t *testing.T) {
+	// Adding the steps for the options must leave the shared default chain as
+	// it was
+	before := len(DefaultPreprocessors)
+	opts := DefaultOptions()
+	opts.Aliases = map[rune]rune{':': '/'}
+	opts.DecimalComma = true
+	if steps := PreprocessorsFor(opts); len(steps) != before+3 {
+		t.Errorf("PreprocessorsFor gave %d steps, want %d", len(steps), before+3)
+	}
+	if len(DefaultPreprocessors) != before {
+		t.Errorf("PreprocessorsFor changed DefaultPreprocessors to %d steps", len(DefaultPreprocessors))
+	}
+}
+
+func TestTrailingSeparatorStrict(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "1+1;", err: `trailing separator ";" is not allowed at position 4`},
+		{expr: "1+1;  ", err: `trailing separator ";" is not allowed at position 4`},
+		{expr: "x = 1; x + 1;", err: `trailing separator ";" is not allowed at position 13`},
+		{expr: "1,", err: `trailing separator "," is not allowed`},
+		{expr: "max(1,2,)", err: `trailing separator "," is not allowed`},
+		{expr: "max(1, 2, )", err: `trailing separator "," is not allowed`},
+		{expr: "1;2", want: "2"},
+		{expr: "1;;2", want: "2"},
+		{expr: "max(1,2)", want: "2"},
+	})
+}
+
+func TestTrailingSeparatorLenient(t *testing.T) {
+	opts := DefaultOptions()
+	opts.LenientSeparators = true
+	checkCases(t, opts, []calcCase{
+		{expr: "1+1;", want: "2"},
+		{expr: "1+1;  ", want: "2"},
+		{expr: "x = 1; x + 1;", want: "2"},
+		{expr: "1,", want: "1"},
+		{expr: "max(1,2,)", want: "2"},
+		{expr: "max(1, 2, )", want: "2"},
+		{expr: "max(1,2,) + min(3,4,)", want: "5"},
+		{expr: "1+1;;", err: `trailing separator ";" is not allowed at position 4`},
+		{expr: "max(1,2,,)", err: `trailing separator "," is not allowed`},
+		{expr: "max(,)", err: "invalid expression at position 5"},
+		{expr: ";", err: "expression is empty"},
+	})
+
+	opts.DecimalComma = true
+	checkCases(t, opts, []calcCase{
+		{expr: "max(1,5; 2;)", want: "2"},
+		{expr: "1,5 + 1;", want: "2.5"},
+	})
+}
+
+func TestDecimalComma(t *testing.T) {
+	opts := DefaultOptions()
+	opts.DecimalComma = true
+	checkCases(t, opts, []calcCase{
+		{expr: "1,5 + 2,5", want: "4"},
+		{expr: "max(1,5; 2)", want: "2"},
+		{expr: "max(2,5; 2)", want: "2.5"},
+		{expr: "1.000,5 * 2", want: "2001"},
+		{expr: "1,5 + 2.5", err: "misplaced digit group separator at position 8"},
+		{expr: "1.00", err: "misplaced digit group separator at position 2"},
+	})
+}
+
+func TestCheckTrailingSeparator(t *testing.T) {
+	if err := Check("1+1;", DefaultOptions()); err == nil {
+		t.Error("Check accepted 1+1; in strict mode")
+	}
+
+	opts := DefaultOptions()
+	opts.LenientSeparators = true
+	if err := Check("1+1;", opts); err != nil {
+		t.Errorf("Check rejected 1+1; in lenient mode: %v", err)
+	}
+}
+
+func TestSeparatedNumbers(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "23", want: "23"},
+		{expr: "2 + 3", want: "5"},
+		{expr: "(2) 3", want: "6"},
+		{expr: "2 (3)", want: "6"},
+		{expr: "2 3", err: "missing operator between numbers at position 2"},
+		{expr: "2  3", err: "missing operator between numbers at position 2"},
+		{expr: "2\t3", err: "missing operator between numbers at position 2"},
+		{expr: "2 3 4", err: "missing operator between numbers at position 2"},
+		{expr: "2.5 3", err: "missing operator between numbers at position 4"},
+		{expr: "2 .5", err: "missing operator between numbers at position 2"},
+		{expr: "1 + 1 000", err: "unexpected space within number at position 6"},
+		{expr: "x = 2 3", err: "missing operator between numbers at position 6"},
+	})
+}
+
+func TestSpaceInName(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Vars = map[string]float64{"a": 2, "b": 3}
+	checkCases(t, opts, []calcCase{
+		{expr: "sin 1", err: "unexpected space within name at position 4"},
+		{expr: "a b", err: "unexpected space within name at position 2"},
+		{expr: "0xA B", err: "unexpected space within number at position 4"},
+		{expr: "sin (0)", want: "0"},
+		{expr: "2 a", want: "4"},
+		{expr: "a * b", want: "6"},
+		{expr: "0xA + 0xB", want: "21"},
+	})
+}
+
+func TestSpaceInNumber(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "1 + 2", want: "3"},
+		{expr: "1000 + 5", want: "1005"},
+		{expr: "1 000 + 5", err: "unexpected space within number at position 2"},
+		{expr: "12 345", err: "unexpected space within number at position 3"},
+		{expr: "1 000 000", err: "unexpected space within number at position 2"},
+		{expr: "1 0000", err: "missing operator between numbers at position 2"},
+		{expr: "1.5 000", err: "missing operator between numbers at position 4"},
+		{expr: "2e-1", want: "0.2"},
+		{expr: "2e - 1", err: "unexpected space within number at position 3"},
+		{expr: "2E -1", err: "unexpected space within number at position 3"},
+		{expr: "2e- 1", err: "unexpected space within number at position 4"},
+		{expr: "2e 1", err: "unexpected space within number at position 3"},
+		{expr: "2 e-1", err: "unexpected space within number at position 2"},
+		{expr: "1.5e + 3", err: "unexpected space within number at position 5"},
+		{expr: "2e - pi", err: "invalid number: 2e-pi at position 1"},
+		{expr: "0x1e - 1", want: "29"},
+		{expr: "e - 1", want: "1.7183"},
+	})
+}
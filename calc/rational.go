@@ -0,0 +1,259 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxRatExponent bounds integer powers in exact mode, whose results grow
+// without limit
+const maxRatExponent = 10000
+
+// maxRatBits bounds the size of the numerator and denominator of exact
+// results, about 19,700 decimal digits, since computing and printing bigger
+// ones can't be interrupted by the timeout
+const maxRatBits = 1 << 16
+
+// ErrRatTooLarge is reported for an exact result whose numerator or
+// denominator would have more than maxRatBits bits
+var ErrRatTooLarge = fmt.Errorf("result too large to compute exactly, the limit is %d bits", maxRatBits)
+
+// ratBits returns the bit length of the larger of r's numerator and
+// denominator
+func ratBits(r *big.Rat) int {
+	return max(r.Num().BitLen(), r.Denom().BitLen())
+}
+
+// parseRat converts a number or constant token to an exact rational
+func parseRat(token string) (*big.Rat, error) {
+	if rat, ok := new(big.Rat).SetString(token); ok {
+		return rat, nil
+	}
+
+	// Built-in constants are irrational
+	if _, irrational := constants[token]; irrational {
+		return nil, fmt.Errorf("%s has no exact rational value", token)
+	}
+
+	// Physics constants are defined by exact decimal values
+	val, err := parseOperand(token)
+	if err != nil {
+		return nil, err
+	}
+	rat, _ := new(big.Rat).SetString(strconv.FormatFloat(val, 'g', -1, 64))
+	return rat, nil
+}
+
+// ratInt returns r as an integer, or false if it has a fractional part
+func ratInt(r *big.Rat) (*big.Int, bool) {
+	if !r.IsInt() {
+		return nil, false
+	}
+	return new(big.Int).Set(r.Num()), true
+}
+
+// isIntegerArithmetic reports whether the tree only combines integer
+// literals with + - * /, so its exact result is a fraction of integers
+func isIntegerArithmetic(node *Node) bool {
+	if node == nil {
+		return true
+	}
+	if node.IsCall() {
+		return false
+	}
+	if node.Left == nil && node.Right == nil {
+		digits := strings.TrimPrefix(node.Value, "-")
+		return digits != "" && strings.Trim(digits, "0123456789") == ""
+	}
+	if !strings.Contains("+-*/", node.Value) || len(node.Value) != 1 {
+		return false
+	}
+	return isIntegerArithmetic(node.Left) && isIntegerArithmetic(node.Right)
+}
+
+// evaluateRat evaluates the tree exactly over the rationals
+func evaluateRat(ctx context.Context, node *Node) (*big.Rat, error) {
+	if node == nil {
+		return new(big.Rat), nil
+	}
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	// Functions have no exact rational form
+	if node.IsCall() {
+		return nil, fmt.Errorf("%s is not supported in exact mode", node.Value)
+	}
+
+	// If it's a number, return it
+	if node.Left == nil && node.Right == nil {
+		return parseRat(node.Value)
+	}
+
+	// Handle unary minus case
+	if node.Left == nil && node.Value == "-" {
+		val, err := evaluateRat(ctx, node.Right)
+		if err != nil {
+			return nil, err
+		}
+		return val.Neg(val), nil
+	}
+
+	// Handle postfix factorial
+	if node.Right == nil && node.Value == "!" {
+		val, err := evaluateRat(ctx, node.Left)
+		if err != nil {
+			return nil, err
+		}
+
+		n, ok := ratInt(val)
+		if !ok || n.Sign() < 0 {
+			return nil, errors.New("factorial requires a non-negative integer")
+		}
+		if n.Cmp(big.NewInt(maxDecimalFactorial)) > 0 {
+			return nil, errors.New("factorial overflow")
+		}
+		return new(big.Rat).SetInt(new(big.Int).MulRange(1, n.Int64())), nil
+	}
+
+	// Handle postfix percent
+	if isPercent(node) {
+		val, err := evaluateRat(ctx, node.Left)
+		if err != nil {
+			return nil, err
+		}
+		return val.Quo(val, big.NewRat(100, 1)), nil
+	}
+
+	// Evaluate left and right subtrees
+	leftVal, err := evaluateRat(ctx, node.Left)
+	if err != nil {
+		return nil, err
+	}
+	rightVal, err := evaluateRat(ctx, node.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	// Adding or subtracting a percentage is relative to the left operand
+	if (node.Value == "+" || node.Value == "-") && isPercent(node.Right) {
+		rightVal.Mul(rightVal, leftVal)
+	}
+
+	result, err := ratOperation(node.Value, leftVal, rightVal)
+	if err != nil {
+		return nil, err
+	}
+	if ratBits(result) > maxRatBits {
+		return nil, ErrRatTooLarge
+	}
+	return result, nil
+}
+
+// ratOperation applies a binary operator to exact operands
+func ratOperation(op string, leftVal, rightVal *big.Rat) (*big.Rat, error) {
+	switch op {
+	case "+":
+		return new(big.Rat).Add(leftVal, rightVal), nil
+	case "-":
+		return new(big.Rat).Sub(leftVal, rightVal), nil
+	case "*":
+		return new(big.Rat).Mul(leftVal, rightVal), nil
+	case "/":
+		if rightVal.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+		return new(big.Rat).Quo(leftVal, rightVal), nil
+	case "//":
+		if rightVal.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+
+		// The denominator is positive, so Euclidean division floors
+		quo := new(big.Rat).Quo(leftVal, rightVal)
+		return new(big.Rat).SetInt(new(big.Int).Div(quo.Num(), quo.Denom())), nil
+	case "%":
+		if rightVal.Sign() == 0 {
+			return nil, errors.New("division by zero")
+		}
+
+		// Remainder with the sign of the dividend, like math.Mod
+		quo := new(big.Rat).Quo(leftVal, rightVal)
+		trunc := new(big.Int).Quo(quo.Num(), quo.Denom())
+		return new(big.Rat).Sub(leftVal, new(big.Rat).Mul(rightVal, new(big.Rat).SetInt(trunc))), nil
+	case "^":
+		return ratPow(leftVal, rightVal)
+	case "&", "|", "<<", ">>":
+		return ratBitwise(op, leftVal, rightVal)
+	case "<", ">", "<=", ">=", "==", "!=":
+		return new(big.Rat).SetFloat64(compare(op, leftVal.Cmp(rightVal))), nil
+	default:
+		return nil, errors.New("unknown operator: " + op)
+	}
+}
+
+// ratPow raises base to an integer exponent
+func ratPow(base, exponent *big.Rat) (*big.Rat, error) {
+	n, ok := ratInt(exponent)
+	if !ok {
+		return nil, errors.New("exact mode only supports integer exponents")
+	}
+	if n.CmpAbs(big.NewInt(maxRatExponent)) > 0 {
+		return nil, errors.New("exponent too large")
+	}
+	if n.Sign() < 0 && base.Sign() == 0 {
+		return nil, errors.New("division by zero")
+	}
+
+	// The result has about the exponent times the base's bits, checked
+	// before computing it
+	exp := new(big.Int).Abs(n)
+	if exp.Int64()*int64(ratBits(base)) > maxRatBits {
+		return nil, ErrRatTooLarge
+	}
+	num := new(big.Int).Exp(base.Num(), exp, nil)
+	denom := new(big.Int).Exp(base.Denom(), exp, nil)
+
+	if n.Sign() < 0 {
+		num, denom = denom, num
+	}
+	return new(big.Rat).SetFrac(num, denom), nil
+}
+
+// ratBitwise performs a bitwise operation on integer operands
+func ratBitwise(op string, leftVal, rightVal *big.Rat) (*big.Rat, error) {
+	left, leftOK := ratInt(leftVal)
+	right, rightOK := ratInt(rightVal)
+	if !leftOK || !rightOK {
+		return nil, fmt.Errorf("%s requires integer operands", op)
+	}
+
+	switch op {
+	case "&":
+		return new(big.Rat).SetInt(left.And(left, right)), nil
+	case "|":
+		return new(big.Rat).SetInt(left.Or(left, right)), nil
+	}
+
+	// Shifts take a count between 0 and 63, as in float mode
+	if right.Sign() < 0 || right.Cmp(big.NewInt(63)) > 0 {
+		return nil, errors.New("shift count must be an integer between 0 and 63")
+	}
+	if op == ">>" {
+		return new(big.Rat).SetInt(left.Rsh(left, uint(right.Uint64()))), nil
+	}
+	return new(big.Rat).SetInt(left.Lsh(left, uint(right.Uint64()))), nil
+}
+
+// formatRat renders r as a reduced fraction, or as a decimal with the given
+// number of digits when digits is positive
+func formatRat(r *big.Rat, digits int) string {
+	if digits > 0 {
+		return r.FloatString(digits)
+	}
+	return r.RatString()
+}
@@ -0,0 +1,95 @@
+package calc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFractions(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Fractions = true
+	checkCases(t, opts, []calcCase{
+		{expr: "1/3", want: "1/3"},
+		{expr: "2/4", want: "1/2"},
+		{expr: "-1/3", want: "-1/3"},
+		{expr: "1/3 + 1/6", want: "1/2"},
+		{expr: "6/3", want: "2"},
+		{expr: "x=1; x/3", want: "1/3"},
+		{expr: "1.0/3", want: "0.3333"},
+		{expr: "sqrt(4)/3", want: "0.6667"},
+		{expr: "2^3/3", want: "2.6667"},
+		{expr: "5!/7", want: "17.1429"},
+		{expr: "1/0", err: "division by zero"},
+	})
+
+	// Without the option integers divide as floats
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "1/3", want: "0.3333"},
+	})
+}
+
+func TestFractionField(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Fractions = true
+	for expr, want := range map[string]string{"2/4": "1/2", "1.0/3": ""} {
+		result, err := CalculateResult(expr, opts)
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+		if result.Fraction != want {
+			t.Errorf("%s: fraction %q, want %q", expr, result.Fraction, want)
+		}
+	}
+}
+
+func TestExactSizeLimit(t *testing.T) {
+	exact := DefaultOptions()
+	exact.Exact = true
+	tooLarge := ErrRatTooLarge.Error()
+	checkCases(t, exact, []calcCase{
+		{expr: "2^10 * 2^-3", want: "128"},
+		{expr: "9^9999 > 1", want: "1"},
+		{expr: "(9^9999)^999", err: tooLarge},
+		{expr: "(9^9999)^9999", err: tooLarge},
+		{expr: "(1/3)^70000", err: "exponent too large"},
+		{expr: "(2/7^9999)^3", err: tooLarge},
+		{expr: "9^9999 * 9^9999 * 9^9999", err: tooLarge},
+		{expr: "1/9^9999 + 1/7^9999 + 1/5^9999", err: tooLarge},
+	})
+}
+
+func TestExactDigitsLimit(t *testing.T) {
+	exact := DefaultOptions()
+	exact.Exact = true
+	exact.ExactDigits = MaxExactDigits
+	checkCases(t, exact, []calcCase{{expr: "1/4", want: "0.25" + strings.Repeat("0", MaxExactDigits-2)}})
+
+	exact.ExactDigits = MaxExactDigits + 1
+	checkCases(t, exact, []calcCase{{expr: "1/4", err: "exact digits must be between 0 and 100"}})
+}
+
+func TestExactTimeout(t *testing.T) {
+	exact := DefaultOptions()
+	exact.Exact = true
+
+	// Rejected by size before any of the work the timeout can't interrupt
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := CalculateContext(ctx, "(9^9999)^9999", exact); !errors.Is(err, ErrRatTooLarge) {
+		t.Errorf("(9^9999)^9999: error %v, want %v", err, ErrRatTooLarge)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("(9^9999)^9999 took %v, past the timeout", elapsed)
+	}
+
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if _, err := CalculateContext(expired, "2^100 + 1", exact); !errors.Is(err, ErrTimeout) {
+		t.Errorf("past the deadline: error %v, want %v", err, ErrTimeout)
+	}
+}
@@ -0,0 +1,321 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// isNumeric reports whether the token is a numeric literal, as opposed to
+// a name or a lone sign. The literals bindVars puts in place of names can
+// be negative.
+func isNumeric(token string) bool {
+	token = strings.TrimPrefix(token, "-")
+	return token != "" && (unicode.IsDigit(rune(token[0])) || token[0] == '.')
+}
+
+// radixPrefixes maps the prefixes of hexadecimal, octal and binary integer
+// literals to their bases
+var radixPrefixes = map[string]int{
+	"0x": 16, "0X": 16,
+	"0o": 8, "0O": 8,
+	"0b": 2, "0B": 2,
+}
+
+// isRadixLiteral reports whether the token starts with one of the
+// radixPrefixes, eg. 0xFF
+func isRadixLiteral(token string) bool {
+	_, prefixed := radixPrefixes[token[:min(2, len(token))]]
+	return prefixed
+}
+
+// parseRadix parses a hexadecimal, octal or binary integer literal
+func parseRadix(token string) (int64, error) {
+	return strconv.ParseInt(token[2:], radixPrefixes[token[:2]], 64)
+}
+
+// isConstant reports whether the token names a built-in or physics constant
+func isConstant(token string) bool {
+	_, builtin := constants[token]
+	_, physics := physicsConstants[token]
+	return builtin || physics
+}
+
+// isOperand reports whether the token is a number or a name
+func isOperand(token string) bool {
+	if _, err := strconv.ParseFloat(token, 64); err == nil || isRadixLiteral(token) {
+		return true
+	}
+
+	return token != "" && strings.IndexFunc(token, func(ch rune) bool { return !unicode.IsLetter(ch) }) < 0
+}
+
+// parseOperand returns the value of a number or named constant token
+func parseOperand(token string) (float64, error) {
+	if isRadixLiteral(token) {
+		num, err := parseRadix(token)
+		if err != nil {
+			return 0, errors.New("invalid number: " + token)
+		}
+		return float64(num), nil
+	}
+	if num, err := strconv.ParseFloat(token, 64); err == nil {
+		return num, nil
+	}
+
+	val, exists := constants[token]
+	if !exists {
+		val, exists = physicsConstants[token]
+	}
+	if exists {
+		return val, nil
+	}
+
+	return 0, errors.New("invalid number: " + token)
+}
+
+// Tokenize splits an expression into number, name, operator, parenthesis
+// and comma tokens. Spaces are skipped, and any other character that can't
+// start a token is an error.
+func Tokenize(expression string) ([]string, error) {
+	return TokenizeWith(expression, Options{})
+}
+
+// twoCharOperators are the operators spelled with two characters
+var twoCharOperators = map[string]bool{
+	"<<": true, ">>": true, "//": true,
+	"<=": true, ">=": true, "==": true, "!=": true,
+}
+
+// startsOperand reports whether s begins with a number, name or '('
+func startsOperand(s string) bool {
+	return s != "" && (unicode.IsDigit(rune(s[0])) || unicode.IsLetter(rune(s[0])) || s[0] == '.' || s[0] == '(')
+}
+
+// TokenizeWith is Tokenize, reading postfix percentages as the percent
+// token when opts.Percent is set
+func TokenizeWith(expression string, opts Options) ([]string, error) {
+	tokens, _, err := tokenize(expression, opts)
+	return tokens, err
+}
+
+// tokenize is TokenizeWith, also returning the position each token starts
+// at for reporting errors. Implicit multiplications are at the operand that
+// follows them, and a final entry holds the position just past the end.
+func tokenize(expression string, opts Options) ([]string, []int, error) {
+	var tokens []string
+	var positions []int
+	var number strings.Builder
+	var prevToken string
+	var skipNext bool
+	position, numberStart := 0, 0
+
+	// emit appends tokens starting at pos
+	emit := func(pos int, toks ...string) {
+		for _, tok := range toks {
+			tokens = append(tokens, tok)
+			positions = append(positions, pos)
+		}
+	}
+
+	// depth is the parenthesis nesting, and bars the depth inside each open
+	// absolute value bar, which becomes an abs call, opened at barStarts
+	depth := 0
+	var bars, barStarts []int
+
+	for i, ch := range expression {
+		position++
+		if number.Len() == 0 {
+			numberStart = position
+		}
+
+		if skipNext {
+			skipNext = false
+			continue
+		}
+
+		// ** is an alias for ^
+		if ch == '*' && strings.HasPrefix(expression[i+1:], "*") {
+			ch = '^'
+			skipNext = true
+		}
+
+		// Shifts, floor division and comparisons such as <= are two
+		// characters long, so 5!=3 compares rather than taking a factorial.
+		// 5!==120 is still a factorial compared with ==.
+		if op := expression[i:min(i+2, len(expression))]; twoCharOperators[op] && !(op == "!=" && strings.HasPrefix(expression[i+2:], "=")) {
+			if number.Len() > 0 {
+				emit(numberStart, number.String())
+				number.Reset()
+			}
+
+			emit(position, op)
+			prevToken = op
+			skipNext = true
+			continue
+		}
+
+		switch {
+		case unicode.IsDigit(ch) || ch == '.': // If digit, accumulate it
+			// Check for implicit multiplication: ')' followed by a number
+			if number.Len() == 0 && len(tokens) > 0 && tokens[len(tokens)-1] == ")" {
+				emit(position, "*")
+				prevToken = "*"
+			}
+
+			number.WriteRune(ch)
+		case (ch == 'e' || ch == 'E') && isNumeric(number.String()): // If exponent, eg. 1e3
+			number.WriteRune(ch)
+		case unicode.IsLetter(ch) && (isRadixLiteral(number.String()) || number.String() == "0" && radixPrefixes["0"+string(ch)] > 0): // If integer literal with a base, eg. 0xFF
+			// Every letter is kept so checkNumber can reject eg. 0xG
+			number.WriteRune(ch)
+		case (ch == '+' || ch == '-') && isNumeric(number.String()) && !isRadixLiteral(number.String()) && strings.HasSuffix(strings.ToLower(number.String()), "e"): // If exponent sign, eg. 1e-3
+			number.WriteRune(ch)
+		case unicode.IsLetter(ch): // If letter, accumulate a constant name
+			if number.Len() > 0 {
+				// Check for implicit multiplication: number followed by a name
+				last := rune(number.String()[number.Len()-1])
+				if unicode.IsDigit(last) || last == '.' {
+					emit(numberStart, number.String())
+					emit(position, "*")
+					prevToken = "*"
+					number.Reset()
+					numberStart = position
+				}
+			} else if len(tokens) > 0 && tokens[len(tokens)-1] == ")" {
+				emit(position, "*")
+				prevToken = "*"
+			}
+
+			number.WriteRune(ch)
+		case ch == '|' && (startsAbs(number.String(), prevToken) || len(bars) > 0 && bars[len(bars)-1] == depth): // If absolute value bar, eg. |3-7|
+			// A bar where an operand is expected opens, any other closes
+			opens := startsAbs(number.String(), prevToken)
+			if number.Len() > 0 {
+				emit(numberStart, number.String())
+				number.Reset()
+			}
+
+			if opens {
+				emit(position, "abs", "(")
+				prevToken = "("
+				depth++
+				bars = append(bars, depth)
+				barStarts = append(barStarts, position)
+				continue
+			}
+
+			emit(position, ")")
+			prevToken = ")"
+			depth--
+			bars = bars[:len(bars)-1]
+			barStarts = barStarts[:len(barStarts)-1]
+		case ch == '+' || ch == '-' || ch == '*' || ch == '/' || ch == '%' || ch == '^' || ch == '&' || ch == '|' || ch == '<' || ch == '>': // If operator
+			// A percentage, eg. 50%, 200 + 10%
+			if ch == '%' && opts.Percent && !startsOperand(expression[i+1:]) {
+				if number.Len() > 0 {
+					emit(numberStart, number.String())
+					number.Reset()
+				}
+
+				emit(position, percent)
+				prevToken = percent
+				continue
+			}
+
+			// Unary plus is a no-op, so drop it, eg. +5, 3*+2, -+3
+			if _, afterOperator := precedence[prevToken]; ch == '+' && number.Len() == 0 && (prevToken == "(" || prevToken == "," || prevToken == "" || afterOperator) {
+				continue
+			}
+
+			if number.Len() > 0 {
+				emit(numberStart, number.String())
+				prevToken = number.String() // So a following '-' is read as binary
+				number.Reset()
+			}
+
+			// Store operator separately. A unary minus is a token of its
+			// own too, so BuildTree can bind it looser than ^ and !, making
+			// -2^2 -(2^2) and -3! -(3!).
+			emit(position, string(ch))
+			prevToken = string(ch)
+
+		// If parenthesis
+		case ch == '(' || ch == ')':
+			if number.Len() > 0 {
+				emit(numberStart, number.String())
+				prevToken = number.String() // So a following '-' is read as binary
+				number.Reset()
+			}
+
+			// Check for implicit multiplication: number followed by '(',
+			// but not a function whose name ends in a digit, eg. atan2(
+			if ch == '(' && len(tokens) > 0 {
+				lastToken := tokens[len(tokens)-1]
+				lastChar := rune(lastToken[len(lastToken)-1])
+				if unicode.IsDigit(lastChar) && !isFunction(lastToken) || isRadixLiteral(lastToken) || isConstant(lastToken) || lastToken == ")" {
+					emit(position, "*")
+				}
+			}
+
+			// A parenthesis can't close inside a bar opened after it
+			if ch == ')' && len(bars) > 0 && bars[len(bars)-1] == depth {
+				return nil, nil, errorAt(position, ErrUnmatchedBar)
+			}
+			if ch == '(' {
+				depth++
+			} else {
+				depth--
+			}
+
+			emit(position, string(ch)) // Store parentheses separately
+			prevToken = string(ch)
+		case ch == ',': // If argument separator
+			if number.Len() > 0 {
+				emit(numberStart, number.String())
+				number.Reset()
+			}
+
+			emit(position, ",")
+			prevToken = ","
+		case ch == '!': // If factorial
+			if number.Len() > 0 {
+				emit(numberStart, number.String())
+				number.Reset()
+			}
+
+			emit(position, "!") // Store postfix operator separately
+			prevToken = "!"
+		case ch == ' ': // Ignore spaces
+			continue
+		default:
+			return nil, nil, &ExprError{Pos: position, Msg: fmt.Sprintf("unexpected character %q", ch)}
+		}
+	}
+
+	// Add last accumulated number
+	if number.Len() > 0 {
+		emit(numberStart, number.String())
+	}
+
+	if len(bars) > 0 {
+		return nil, nil, errorAt(barStarts[len(barStarts)-1], ErrUnmatchedBar)
+	}
+	return tokens, append(positions, position+1), nil
+}
+
+// ErrUnmatchedBar is reported for an absolute value bar without its pair
+var ErrUnmatchedBar = errors.New("unmatched absolute value bar |")
+
+// startsAbs reports whether a '|' read with the given pending number and
+// previous token opens an absolute value, being where an operand is
+// expected. Elsewhere a '|' closes the innermost bar, or is bitwise or.
+func startsAbs(number, prevToken string) bool {
+	if number != "" {
+		return false
+	}
+	_, afterOperator := precedence[prevToken]
+	return prevToken == "" || prevToken == "(" || prevToken == "," || afterOperator
+}
@@ -0,0 +1,171 @@
+package calc
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBinaryMinus(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "1-2", want: "-1"},
+		{expr: "1 - 2", want: "-1"},
+		{expr: "1-2-3", want: "-4"},
+		{expr: "(1)-2", want: "-1"},
+		{expr: "2*3-4", want: "2"},
+		{expr: "5!-3", want: "117"},
+		{expr: "pi-3", want: "0.1416"},
+		{expr: "x=5; x-2", want: "3"},
+		{expr: "-1-2", want: "-3"},
+		{expr: "1--2", want: "3"},
+		{expr: "1- -2", want: "3"},
+		{expr: "1-(-2)", want: "3"},
+	})
+}
+
+func TestTokenizeMinus(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "1-2", want: []string{"1", "-", "2"}},
+		{expr: "(1)-2", want: []string{"(", "1", ")", "-", "2"}},
+		{expr: "-1-2", want: []string{"-", "1", "-", "2"}},
+		{expr: "1--2", want: []string{"1", "-", "-", "2"}},
+	}
+	for _, tc := range tests {
+		got, err := Tokenize(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: tokens %q, want %q", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestNumberLiterals(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: ".5", want: "0.5"},
+		{expr: "5.", want: "5"},
+		{expr: "0.5", want: "0.5"},
+		{expr: "5.+1", want: "6"},
+		{expr: ".5*2", want: "1"},
+		{expr: "1.2.3", err: "invalid number: 1.2.3 has more than one decimal point at position 1"},
+		{expr: "1..2", err: "invalid number: 1..2 has more than one decimal point at position 1"},
+		{expr: "1.2.3+4", err: "invalid number: 1.2.3 has more than one decimal point at position 1"},
+		{expr: ".", err: "invalid number: . at position 1"},
+	})
+}
+
+func TestRadixLiterals(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "0x1F", want: "31"},
+		{expr: "0xff+1", want: "256"},
+		{expr: "0xFFe1", want: "65505"},
+		{expr: "0o17", want: "15"},
+		{expr: "0b1010", want: "10"},
+		{expr: "-0x10", want: "-16"},
+		{expr: "2(0x10)", want: "32"},
+		{expr: "0b102", err: "invalid number: 0b102 at position 1"},
+		{expr: "0x", err: "invalid number: 0x at position 1"},
+		{expr: "0b1e2", err: "invalid number: 0b1e2 at position 1"},
+		{expr: "0x1.5", err: "invalid number: 0x1.5, hexadecimal, octal and binary literals are integers at position 1"},
+	})
+}
+
+func TestPowerAlias(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "2**3", want: "8"},
+		{expr: "2**3**2", want: "512"},
+		{expr: "2**3**2 == 2^(3^2)", want: "1"},
+		{expr: "2**-1", want: "0.5"},
+		{expr: "-2**2", want: "-4"},
+		{expr: "(2**3)", want: "8"},
+		{expr: "2*3", want: "6"},
+		{expr: "2***3", err: "invalid expression at position 4"},
+		{expr: "2**", err: "invalid expression at position 4"},
+		{expr: "2* *3", err: "unexpected space within operator at position 3"},
+		{expr: "2 * * 3", err: "unexpected space within operator at position 4"},
+	})
+
+	tokens, err := Tokenize("2**3")
+	if err != nil || !slices.Equal(tokens, []string{"2", "^", "3"}) {
+		t.Errorf("2**3: tokens %q (%v), want the power token", tokens, err)
+	}
+}
+
+func TestImplicitMultiplication(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "2(3)", want: "6"},
+		{expr: "(1+2)(3)", want: "9"},
+		{expr: "(1+2)(3+4)", want: "21"},
+		{expr: "(1+2)3", want: "9"},
+		{expr: "(1).5", want: "0.5"},
+		{expr: "2(3)(4)", want: "24"},
+		{expr: "(2)(3)(4)", want: "24"},
+		{expr: "(2)pi", want: "6.2832"},
+		{expr: "(2)sqrt(4)", want: "4"},
+		{expr: "x=3; (2)x", want: "6"},
+		{expr: "2pi", want: "6.2832"},
+		{expr: "(2) 3", want: "6"},
+	})
+
+	tests := []struct {
+		expr string
+		want []string
+	}{
+		{expr: "2(3)(4)", want: []string{"2", "*", "(", "3", ")", "*", "(", "4", ")"}},
+		{expr: "(1)2", want: []string{"(", "1", ")", "*", "2"}},
+	}
+	for _, tc := range tests {
+		if got, err := Tokenize(tc.expr); err != nil || !slices.Equal(got, tc.want) {
+			t.Errorf("%s: tokens %q (%v), want %q", tc.expr, got, err, tc.want)
+		}
+	}
+}
+
+func TestUnaryPlus(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "+5", want: "5"},
+		{expr: "3*+2", want: "6"},
+		{expr: "-+3", want: "-3"},
+		{expr: "+-3", want: "-3"},
+		{expr: "++5", want: "5"},
+		{expr: "(+5)", want: "5"},
+		{expr: "2^+2", want: "4"},
+		{expr: "max(+1, 2)", want: "2"},
+		{expr: "1++2", want: "3"},
+		{expr: "+", err: "invalid expression at position 2"},
+		{expr: "1+", err: "invalid expression at position 3"},
+	})
+}
+
+func TestFloorDivision(t *testing.T) {
+	cases := []calcCase{
+		{expr: "7 // 2", want: "3"},
+		{expr: "-7 // 2", want: "-4"},
+		{expr: "-7.5 // 2", want: "-4"},
+		{expr: "7 // 0", err: "division by zero"},
+	}
+	checkCases(t, DefaultOptions(), append(cases, []calcCase{
+		{expr: "7 / 2", want: "3.5"},
+		{expr: "-7 / 2", want: "-3.5"},
+		{expr: "7.5 // 2", want: "3"},
+		{expr: "2 // -0.5", want: "-4"},
+		{expr: "8 // 2 // 2", want: "2"},
+		{expr: "2 * 7 // 2", want: "7"},
+		{expr: "7 /// 2", err: "invalid expression at position 5"},
+		{expr: "7 / / 2", err: "unexpected space within operator at position 4"},
+	}...))
+
+	for _, mode := range []func(*Options){
+		func(opts *Options) { opts.Exact = true },
+		func(opts *Options) { opts.Decimal = true },
+		func(opts *Options) { opts.Complex = true },
+	} {
+		opts := DefaultOptions()
+		mode(&opts)
+		checkCases(t, opts, cases)
+	}
+}
@@ -0,0 +1,218 @@
+package calc
+
+import "strings"
+
+// Node represents a binary tree node for an expression. Function calls
+// hold their arguments in Args instead.
+type Node struct {
+	Value string  `json:"value"`
+	Left  *Node   `json:"left,omitempty"`
+	Right *Node   `json:"right,omitempty"`
+	Args  []*Node `json:"args,omitempty"`
+}
+
+// IsCall reports whether the node is a function call
+func (n *Node) IsCall() bool {
+	return n.Left == nil && n.Right == nil && isFunction(n.Value)
+}
+
+// String returns the fully parenthesized form of the subtree
+func (n *Node) String() string {
+	if n == nil {
+		return ""
+	}
+
+	if n.IsCall() {
+		// A single binary or negated argument is already parenthesized
+		if len(n.Args) == 1 && n.Args[0].Right != nil {
+			return n.Value + n.Args[0].String()
+		}
+
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = arg.String()
+		}
+		return n.Value + "(" + strings.Join(args, ", ") + ")"
+	}
+
+	if n.Left == nil && n.Right == nil {
+		return n.Value
+	}
+
+	if n.Left == nil {
+		return "(" + n.Value + n.Right.String() + ")"
+	}
+
+	if n.Right == nil {
+		return n.Left.String() + n.Value
+	}
+
+	return "(" + n.Left.String() + " " + n.Value + " " + n.Right.String() + ")"
+}
+
+// precedence ranks the binary operators and unary minus. Comparisons and
+// then bitwise operators bind loosest, as in Python, so 1 + 2 << 3 is
+// (1+2) << 3 and 1 + 1 == 2 is (1+1) == 2. Unary minus binds tighter than *
+// but looser than ^, so -2^2 is -(2^2) and 2^-2^2 is 2^(-(2^2)).
+var precedence = map[string]int{
+	"<": 1, ">": 1, "<=": 1, ">=": 1, "==": 1, "!=": 1,
+	"|":  2,
+	"&":  3,
+	"<<": 4, ">>": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "//": 6, "%": 6,
+	unaryMinus: 7,
+	"^":        8,
+}
+
+// isComparison reports whether the token is a comparison operator
+func isComparison(token string) bool {
+	return precedence[token] == precedence["=="]
+}
+
+// rightAssociative operators group from the right, so 2^3^2 is 2^(3^2).
+// Every other binary operator groups from the left, so 10-2-3 is (10-2)-3
+// and 100/10/2 is (100/10)/2.
+var rightAssociative = map[string]bool{
+	"^":        true,
+	unaryMinus: true,
+}
+
+// unaryMinus marks a prefix '-' on the operator stack
+const unaryMinus = "u-"
+
+// percent is the token for a postfix '%', telling it apart from modulo. It
+// becomes a "%" node with only a Left operand.
+const percent = "%%"
+
+// isPercent reports whether the node is a postfix percentage
+func isPercent(n *Node) bool {
+	return n != nil && n.Value == "%" && n.Left != nil && n.Right == nil
+}
+
+// BuildTree parses the tokens into an expression tree using the
+// shunting-yard algorithm, in a single pass over the tokens. An operator
+// first applies the stacked operators of higher precedence, and of equal
+// precedence unless it is right associative, which makes chains such as
+// 1+2-3*4/5 group from the left within each precedence level. It returns
+// nil for malformed input.
+func BuildTree(tokens []string) *Node {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	var operands []*Node
+	var operators []string
+
+	// bases holds the operand count at each open '(', so the arguments of a
+	// function call are the operands pushed since
+	var bases []int
+
+	// apply pops an operator's operands and pushes the resulting node
+	apply := func(op string) bool {
+		switch {
+		case op == unaryMinus:
+			if len(operands) < 1 {
+				return false
+			}
+			operands[len(operands)-1] = &Node{Value: "-", Right: operands[len(operands)-1]}
+		default:
+			if len(operands) < 2 {
+				return false
+			}
+			left, right := operands[len(operands)-2], operands[len(operands)-1]
+			operands = operands[:len(operands)-1]
+			operands[len(operands)-1] = &Node{Value: op, Left: left, Right: right}
+		}
+		return true
+	}
+
+	for i, token := range tokens {
+		// A '-' is unary at the start, after '(' or ',' or after another operator
+		unary := i == 0 || tokens[i-1] == "(" || tokens[i-1] == ","
+		if i > 0 {
+			_, afterOperator := precedence[tokens[i-1]]
+			unary = unary || afterOperator
+		}
+
+		switch {
+		case token == "(":
+			operators = append(operators, token)
+			bases = append(bases, len(operands))
+		case isFunction(token) && i+1 < len(tokens) && tokens[i+1] == "(":
+			operators = append(operators, token)
+		case token == "," || token == ")":
+			// Pop back to the enclosing '('
+			for len(operators) > 0 && operators[len(operators)-1] != "(" {
+				if !apply(operators[len(operators)-1]) {
+					return nil
+				}
+				operators = operators[:len(operators)-1]
+			}
+			if len(operators) == 0 {
+				return nil
+			}
+			if token == "," {
+				continue
+			}
+
+			operators = operators[:len(operators)-1]
+			base := bases[len(bases)-1]
+			bases = bases[:len(bases)-1]
+
+			// Gather a function call's arguments
+			if len(operators) > 0 && isFunction(operators[len(operators)-1]) {
+				args := append([]*Node{}, operands[base:]...)
+				operands = append(operands[:base], &Node{Value: operators[len(operators)-1], Args: args})
+				operators = operators[:len(operators)-1]
+			} else if len(operands)-base != 1 {
+				return nil
+			}
+		case token == "!" || token == percent:
+			// Postfix factorial and percent bind tighter than any other operator
+			if len(operands) == 0 {
+				return nil
+			}
+			value := token
+			if token == percent {
+				value = "%"
+			}
+			operands[len(operands)-1] = &Node{Value: value, Left: operands[len(operands)-1]}
+		case token == "-" && unary:
+			operators = append(operators, unaryMinus)
+		case precedence[token] > 0:
+			// Apply stacked operators that bind at least as tightly
+			for len(operators) > 0 {
+				top := operators[len(operators)-1]
+				if top == "(" || isFunction(top) {
+					break
+				}
+				if precedence[top] < precedence[token] || (precedence[top] == precedence[token] && rightAssociative[token]) {
+					break
+				}
+				if !apply(top) {
+					return nil
+				}
+				operators = operators[:len(operators)-1]
+			}
+			operators = append(operators, token)
+		case isOperand(token):
+			operands = append(operands, &Node{Value: token})
+		default:
+			return nil
+		}
+	}
+
+	for len(operators) > 0 {
+		top := operators[len(operators)-1]
+		if top == "(" || isFunction(top) || !apply(top) {
+			return nil
+		}
+		operators = operators[:len(operators)-1]
+	}
+
+	if len(operands) != 1 {
+		return nil
+	}
+	return operands[0]
+}
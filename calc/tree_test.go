@@ -0,0 +1,98 @@
+package calc
+
+import "testing"
+
+func TestAssociativity(t *testing.T) {
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "8-3-2", want: "3"},
+		{expr: "10-2-3-1", want: "4"},
+		{expr: "64/4/2", want: "8"},
+		{expr: "100/10/2", want: "5"},
+		{expr: "100//7//2", want: "7"},
+		{expr: "-7//2//2", want: "-2"},
+		{expr: "100%7%4", want: "2"},
+		{expr: "2^3^2", want: "512"},
+		{expr: "2**3**2", want: "512"},
+		{expr: "2^-1^2", want: "0.5"},
+		{expr: "8-3+2", want: "7"},
+		{expr: "8+3-2", want: "9"},
+		{expr: "64/4*2", want: "32"},
+		{expr: "64*4/2", want: "128"},
+		{expr: "20/4%3", want: "2"},
+		{expr: "20%6/2", want: "1"},
+		{expr: "17//5*2", want: "6"},
+		{expr: "10-2^2^0", want: "8"},
+		{expr: "2*3^2/6", want: "3"},
+		{expr: "1+2-3*4/5", want: "0.6"},
+		{expr: "16 >> 2 >> 1", want: "2"},
+		{expr: "1 << 2 << 3", want: "32"},
+		{expr: "12 - 5 & 6", want: "6"},
+	})
+}
+
+func TestAssociativityModes(t *testing.T) {
+	cases := []calcCase{
+		{expr: "8-3-2", want: "3"},
+		{expr: "64/4/2", want: "8"},
+		{expr: "100//7//2", want: "7"},
+		{expr: "100%7%4", want: "2"},
+	}
+
+	exact := DefaultOptions()
+	exact.Exact = true
+	checkCases(t, exact, append(cases, calcCase{expr: "2^3^2", want: "512"}, calcCase{expr: "1/2/3", want: "1/6"}))
+
+	dec := DefaultOptions()
+	dec.Decimal = true
+	checkCases(t, dec, cases)
+
+	cplx := DefaultOptions()
+	cplx.Complex = true
+	checkCases(t, cplx, append(cases, calcCase{expr: "2^3^2", want: "512"}))
+}
+
+func TestAssociativityTree(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "8-3-2", want: "((8 - 3) - 2)"},
+		{expr: "64/4/2", want: "((64 / 4) / 2)"},
+		{expr: "9//4//2", want: "((9 // 4) // 2)"},
+		{expr: "9%4%2", want: "((9 % 4) % 2)"},
+		{expr: "2^3^2", want: "(2 ^ (3 ^ 2))"},
+		{expr: "1-2+3", want: "((1 - 2) + 3)"},
+		{expr: "1/2*3", want: "((1 / 2) * 3)"},
+	}
+	for _, tc := range tests {
+		tree, err := Parse(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got := tree.String(); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestComparisons(t *testing.T) {
+	chained := "comparisons can't be chained, use parentheses, eg. (1 < 2) == 1 at position 7"
+	checkCases(t, DefaultOptions(), []calcCase{
+		{expr: "3 > 2", want: "1"},
+		{expr: "2 == 2", want: "1"},
+		{expr: "1 < 0", want: "0"},
+		{expr: "1 <= 1", want: "1"},
+		{expr: "2 >= 3", want: "0"},
+		{expr: "1 != 2", want: "1"},
+		{expr: "1 + 1 == 2", want: "1"},
+		{expr: "2 * 3 > 5", want: "1"},
+		{expr: "(1 < 2) == (3 < 4)", want: "1"},
+		{expr: "(1 < 2) + (3 < 4)", want: "2"},
+		{expr: "x=1; x==1", want: "1"},
+		{expr: "3! != 6", want: "0"},
+		{expr: "1 < 2 < 3", err: chained},
+		{expr: "1 < 2 == 1", err: chained},
+		{expr: "1 <> 2", err: "invalid expression at position 4"},
+	})
+}
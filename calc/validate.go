@@ -0,0 +1,336 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// numberPattern matches the accepted numeric literals: digits with an
+// optional decimal point, where either side of the point may be empty but
+// not both, and an optional exponent. So .5, 5. and 0.5 are all numbers.
+var numberPattern = regexp.MustCompile(`^(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
+
+// radixPattern matches hexadecimal, octal and binary integer literals such
+// as 0xFF, 0o17 and 0b1010. They have no fractional part or exponent.
+var radixPattern = regexp.MustCompile(`^0([xX][0-9a-fA-F]+|[oO][0-7]+|[bB][01]+)$`)
+
+// checkNumber rejects malformed numeric literals with a hint at the problem
+func checkNumber(number string) error {
+	if isRadixLiteral(number) {
+		switch {
+		case strings.Contains(number, "."):
+			return fmt.Errorf("invalid number: %s, hexadecimal, octal and binary literals are integers", number)
+		case !radixPattern.MatchString(number):
+			return fmt.Errorf("invalid number: %s", number)
+		}
+		if _, err := parseRadix(number); err != nil {
+			return fmt.Errorf("invalid number: %s is out of range", number)
+		}
+		return nil
+	}
+
+	switch {
+	case strings.Count(number, ".") > 1:
+		return fmt.Errorf("invalid number: %s has more than one decimal point", number)
+	case !numberPattern.MatchString(number):
+		return fmt.Errorf("invalid number: %s", number)
+	}
+
+	// The literal is well formed, but may still be out of range
+	if _, err := strconv.ParseFloat(number, 64); err != nil {
+		return fmt.Errorf("invalid number: %s is out of range", number)
+	}
+	return nil
+}
+
+// ErrTooDeep is reported for expressions nested deeper than the allowed depth
+var ErrTooDeep = errors.New("expression too deeply nested")
+
+// CheckDepth rejects expressions whose parentheses nest deeper than
+// maxDepth, before any recursive parsing or evaluation sees them. A
+// non-positive maxDepth means DefaultMaxDepth.
+func CheckDepth(Expr string, maxDepth int) error {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	depth := 0
+	for _, ch := range Expr {
+		switch ch {
+		case '(':
+			depth++
+			if depth > maxDepth {
+				return ErrTooDeep
+			}
+		case ')':
+			depth--
+		}
+	}
+
+	return nil
+}
+
+// ErrUnbalancedParens is reported when parentheses don't pair up
+var ErrUnbalancedParens = errors.New("unbalanced parentheses")
+
+// CheckParens reports whether every ')' closes an earlier '(' and every '('
+// is closed, at the position of the first stray ')' or last unclosed '('
+func CheckParens(Expr string) error {
+	var open []int
+	position := 0
+	for _, ch := range Expr {
+		position++
+		switch ch {
+		case '(':
+			open = append(open, position)
+		case ')':
+			if len(open) == 0 {
+				return errorAt(position, ErrUnbalancedParens)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+
+	if len(open) != 0 {
+		return errorAt(open[len(open)-1], ErrUnbalancedParens)
+	}
+	return nil
+}
+
+// Validate checks that the expression is well formed for the given options
+func Validate(Expr string, opts Options) error {
+	return validate(Expr, opts, func(token string) bool {
+		_, builtin := constants[token]
+		_, bound := opts.Vars[token]
+		return builtin || bound || (opts.Physics && isConstant(token)) || (opts.Complex && token == imaginaryUnit)
+	})
+}
+
+// validate is Validate, accepting the value names isName reports as known
+func validate(Expr string, opts Options, isName func(string) bool) error {
+	if err := CheckDepth(Expr, opts.MaxDepth); err != nil {
+		return err
+	}
+
+	if err := checkCharacters(Expr); err != nil {
+		return err
+	}
+
+	if err := CheckParens(Expr); err != nil {
+		return err
+	}
+
+	return validateNames(Expr, isName, opts)
+}
+
+// ValidateNames validates an expression that may call functions
+// and reference the value names accepted by isName. The structure is
+// checked on the token stream, so implicit multiplication such as 2c is
+// accepted once the tokenizer has made it explicit.
+func ValidateNames(Expr string, isName func(string) bool) error {
+	return validateNames(Expr, isName, Options{})
+}
+
+// allowedCharacters matches the characters an expression may contain
+var allowedCharacters = regexp.MustCompile(`^[0-9A-Za-z\+\-\*/%\^&|<>=!\(\)\s.,]+$`)
+
+// checkCharacters rejects an expression with a character that can't appear
+// in any token, at the position of the first one
+func checkCharacters(Expr string) error {
+	if allowedCharacters.MatchString(Expr) {
+		return nil
+	}
+
+	position := 0
+	for _, ch := range Expr {
+		position++
+		if !allowedCharacters.MatchString(string(ch)) {
+			return &ExprError{Pos: position, Msg: fmt.Sprintf("unexpected character %q", ch), Err: ErrInvalidExpression}
+		}
+	}
+	return ErrInvalidExpression
+}
+
+// maxListedNames is the most unknown names listed in one error
+const maxListedNames = 10
+
+// validateNames is ValidateNames with the syntax selected by opts
+func validateNames(Expr string, isName func(string) bool, opts Options) error {
+	if err := checkCharacters(Expr); err != nil {
+		return err
+	}
+
+	tokens, positions, err := tokenize(Expr, opts)
+	if err != nil {
+		return err
+	}
+
+	for i, token := range tokens {
+		if token == "!" && (i == 0 || !(isOperand(tokens[i-1]) || tokens[i-1] == ")" || tokens[i-1] == "!")) {
+			return errorAt(positions[i], errors.New("factorial must follow a number or closing parenthesis"))
+		}
+	}
+
+	var unknown []string
+	seen := make(map[string]bool)
+	unknownAt := 0
+	for i, token := range tokens {
+		followedByParen := i+1 < len(tokens) && tokens[i+1] == "("
+
+		switch {
+		case isNumeric(token):
+			if err := checkNumber(token); err != nil {
+				return errorAt(positions[i], err)
+			}
+		case strings.IndexFunc(token, unicode.IsLetter) < 0:
+		case isFunction(token) && !followedByParen && functions[token].maxArgs == 0:
+			return errorAt(positions[i], fmt.Errorf("function %s must be called with parentheses, eg. %s()", token, token))
+		case isFunction(token) && !followedByParen:
+			return errorAt(positions[i], fmt.Errorf("function %s must be called with parentheses, eg. %s(2)", token, token))
+		case isFunction(token):
+		case followedByParen:
+			return errorAt(positions[i], fmt.Errorf("unknown function: %s", token))
+		case !isName(token) && token == Ans:
+			return errorAt(positions[i], ErrNoPreviousResult)
+		case !isName(token) && !seen[token]:
+			if unknown == nil {
+				unknownAt = positions[i]
+			}
+			seen[token] = true
+			unknown = append(unknown, token)
+		}
+	}
+
+	// Report every unknown name at once, so they can all be defined, up to
+	// a limit so the message stays readable
+	switch len(unknown) {
+	case 0:
+	case 1:
+		return errorAt(unknownAt, fmt.Errorf("unknown name: %s", unknown[0]))
+	default:
+		listed := strings.Join(unknown[:min(len(unknown), maxListedNames)], ", ")
+		if len(unknown) > maxListedNames {
+			listed += fmt.Sprintf(" and %d more", len(unknown)-maxListedNames)
+		}
+		return errorAt(unknownAt, fmt.Errorf("unknown names: %s", listed))
+	}
+
+	if err := checkStructure(tokens, positions); err != nil {
+		return err
+	}
+	return checkComparisons(tokens, positions)
+}
+
+// ErrChainedComparison is reported for comparisons such as 1 < 2 < 3, which
+// would otherwise compare the 0 or 1 result of the first with 3
+var ErrChainedComparison = errors.New("comparisons can't be chained, use parentheses, eg. (1 < 2) == 1")
+
+// checkComparisons rejects more than one comparison in the same
+// parenthesized group or function argument
+func checkComparisons(tokens []string, positions []int) error {
+	// compared tracks whether each open group has a comparison yet
+	compared := []bool{false}
+
+	for i, token := range tokens {
+		switch {
+		case token == "(":
+			compared = append(compared, false)
+		case token == ")":
+			compared = compared[:len(compared)-1]
+		case token == ",":
+			compared[len(compared)-1] = false
+		case isComparison(token):
+			if compared[len(compared)-1] {
+				return errorAt(positions[i], ErrChainedComparison)
+			}
+			compared[len(compared)-1] = true
+		}
+	}
+
+	return nil
+}
+
+// checkStructure checks the token sequence against the supported grammar:
+// operands and parenthesized subexpressions joined by binary operators,
+// each optionally negated by a '-' and followed by factorials. Functions
+// are followed by their parenthesized, comma separated arguments, which
+// must match the function's arity. Errors are at the token's position.
+func checkStructure(tokens []string, positions []int) error {
+	// expectOperand is true where a number, name or '(' must come next
+	expectOperand := true
+
+	// calls tracks each open '(', with the function it calls and where
+	// that is named if any, so arity errors point at the function
+	type call struct {
+		function string
+		at       int
+		args     int
+	}
+	var calls []call
+
+	for i, token := range tokens {
+		// An empty argument list closes straight away
+		if expectOperand && token == ")" && i > 0 && tokens[i-1] == "(" && len(calls) > 0 && calls[len(calls)-1].function != "" {
+			if err := checkArity(calls[len(calls)-1].function, 0); err != nil {
+				return errorAt(calls[len(calls)-1].at, err)
+			}
+			calls = calls[:len(calls)-1]
+			expectOperand = false
+			continue
+		}
+
+		if expectOperand {
+			switch {
+			case token == "(":
+				opened := call{args: 1}
+				if i > 0 && isFunction(tokens[i-1]) {
+					opened.function, opened.at = tokens[i-1], positions[i-1]
+				}
+				calls = append(calls, opened)
+			case token == "-":
+			case isFunction(token) && i+1 < len(tokens) && tokens[i+1] == "(":
+			case isOperand(token):
+				expectOperand = false
+			default:
+				return errorAt(positions[i], ErrInvalidExpression)
+			}
+			continue
+		}
+
+		switch {
+		case token == ")":
+			if len(calls) == 0 {
+				return errorAt(positions[i], ErrUnbalancedParens)
+			}
+			closed := calls[len(calls)-1]
+			calls = calls[:len(calls)-1]
+			if closed.function != "" {
+				if err := checkArity(closed.function, closed.args); err != nil {
+					return errorAt(closed.at, err)
+				}
+			}
+		case token == ",":
+			// Commas only separate function arguments
+			if len(calls) == 0 || calls[len(calls)-1].function == "" {
+				return errorAt(positions[i], errors.New("comma outside of a function call"))
+			}
+			calls[len(calls)-1].args++
+			expectOperand = true
+		case token == "!" || token == percent:
+		case precedence[token] > 0 && token != unaryMinus:
+			expectOperand = true
+		default:
+			return errorAt(positions[i], ErrInvalidExpression)
+		}
+	}
+
+	// The expression ended where an operand was expected, eg. 1+
+	if expectOperand {
+		return errorAt(positions[len(tokens)], ErrInvalidExpression)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package calc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// hostileInputs are expressions crafted to make a validator slow, near the
+// default server limit of 1000 characters. err is the error expected where
+// the input must be rejected for a particular reason.
+var hostileInputs = []struct {
+	name string
+	expr string
+	err  error
+}{
+	{name: "deepest nesting", expr: strings.Repeat("(", DefaultMaxDepth) + "1" + strings.Repeat(")", DefaultMaxDepth)},
+	{name: "too deep", expr: strings.Repeat("(", DefaultMaxDepth+1) + "1" + strings.Repeat(")", DefaultMaxDepth+1), err: ErrTooDeep},
+	{name: "unclosed", expr: strings.Repeat("(", 999) + "1", err: ErrTooDeep},
+	{name: "max length", expr: strings.Repeat("1+", 499) + "1"},
+	{name: "long number", expr: strings.Repeat("9", 300)},
+	{name: "minus run", expr: strings.Repeat("-", 999) + "1"},
+	{name: "operator run", expr: "1" + strings.Repeat("*", 998) + "1", err: ErrInvalidExpression},
+	{name: "decimal points", expr: strings.Repeat("1.", 500)},
+	{name: "exponents", expr: strings.Repeat("1e1", 333)},
+	{name: "unknown names", expr: strings.Repeat("ab+", 333) + "c"},
+	{name: "comparisons", expr: strings.Repeat("1<", 499) + "1", err: ErrChainedComparison},
+}
+
+func TestValidateHostileInput(t *testing.T) {
+	for _, tc := range hostileInputs {
+		err := Validate(tc.expr, DefaultOptions())
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("%s: error %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
+
+func BenchmarkValidateHostileInput(b *testing.B) {
+	opts := DefaultOptions()
+	for _, tc := range hostileInputs {
+		b.Run(tc.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Validate(tc.expr, opts)
+			}
+		})
+	}
+}
+
+func TestDeepNesting(t *testing.T) {
+	nested := func(open, close string, depth int) string {
+		return strings.Repeat(open, depth) + "1" + strings.Repeat(close, depth)
+	}
+	shallow := DefaultOptions()
+	shallow.MaxDepth = 10
+	exact := DefaultOptions()
+	exact.Exact = true
+	cplx := DefaultOptions()
+	cplx.Complex = true
+	dec := DefaultOptions()
+	dec.Decimal = true
+
+	tests := []struct {
+		name string
+		expr string
+		opts Options
+		err  error
+	}{
+		{name: "default limit", expr: nested("(", ")", DefaultMaxDepth), opts: DefaultOptions()},
+		{name: "past the default limit", expr: nested("(", ")", DefaultMaxDepth+1), opts: DefaultOptions(), err: ErrTooDeep},
+		{name: "50,000 unclosed", expr: strings.Repeat("(", 50000), opts: DefaultOptions(), err: ErrTooDeep},
+		{name: "50,000 nested", expr: nested("(", ")", 50000), opts: DefaultOptions(), err: ErrTooDeep},
+		{name: "nested calls", expr: nested("sqrt(", ")", 50000), opts: DefaultOptions(), err: ErrTooDeep},
+		{name: "exact", expr: nested("(", ")", 50000), opts: exact, err: ErrTooDeep},
+		{name: "complex", expr: nested("(", ")", 50000), opts: cplx, err: ErrTooDeep},
+		{name: "decimal", expr: nested("(", ")", 50000), opts: dec, err: ErrTooDeep},
+		{name: "configured limit", expr: nested("(", ")", 10), opts: shallow},
+		{name: "past the configured limit", expr: nested("(", ")", 11), opts: shallow, err: ErrTooDeep},
+		{name: "50,000 minus signs", expr: strings.Repeat("-", 50000) + "1", opts: DefaultOptions()},
+	}
+	for _, tc := range tests {
+		_, err := CalculateResult(tc.expr, tc.opts)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s: error %v, want %v", tc.name, err, tc.err)
+		}
+	}
+}
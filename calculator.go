@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// Calculator holds the state shared by the request handlers: the history,
+// the web form's sessions, the result cache, the metrics and the batch
+// responses kept for retries. The command line has a single scope of its
+// own. Each part has its own lock, so handlers may run concurrently without
+// racing.
+type Calculator struct {
+	history     *History
+	scope       *Scope
+	sessions    *Sessions
+	cache       *ResultCache
+	metrics     *Metrics
+	idempotency *IdempotencyStore
+}
+
+// NewCalculator returns a calculator recording into history, with a result
+// cache holding up to cacheSize outcomes
+func NewCalculator(history *History, cacheSize int) *Calculator {
+	return &Calculator{
+		history:     history,
+		scope:       NewScope(),
+		sessions:    NewSessions(maxSessions, sessionIdleTimeout),
+		cache:       NewResultCache(cacheSize),
+		metrics:     NewMetrics(),
+		idempotency: NewIdempotencyStore(maxIdempotencyKeys, maxIdempotencyBytes, idempotencyTTL),
+	}
+}
+
+// resetHandler starts afresh: it clears the history, and the session's ans,
+// variables and memory, forgets the remembered expression and returns to an
+// empty form. The history is shared by every user of the server.
+func (c *Calculator) resetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.history.Clear()
+	c.sessions.Scope(w, r).Reset()
+	http.SetCookie(w, &http.Cookie{Name: lastExpressionCookie, Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// memoryHandler operates the memory register with the key form value: M+
+// and M- add and subtract the previous result, MC clears the memory and MR
+// recalls it by calculating MR
+func (c *Calculator) memoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch key := r.FormValue("key"); key {
+	case "M+", "M-":
+		sign := 1.0
+		if key == "M-" {
+			sign = -1
+		}
+		if !c.sessions.Scope(w, r).AddToMemory(sign) {
+			http.Error(w, "no previous result for "+key, http.StatusConflict)
+			return
+		}
+	case "MC":
+		c.sessions.Scope(w, r).ClearMemory()
+	case "MR":
+		http.Redirect(w, r, "/?expr="+calc.Memory, http.StatusSeeOther)
+		return
+	default:
+		http.Error(w, "unknown memory key, use M+, M-, MR or MC", http.StatusBadRequest)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentRequests hits the handlers sharing the calculator's state
+// from many goroutines at once, for go test -race to check: the history,
+// the scope, the result cache and the idempotency store
+func TestConcurrentRequests(t *testing.T) {
+	c := NewCalculator(NewHistory(historySize), 16)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", c.calculatorHandler)
+	mux.Handle("/api/calculate", withRequestID(http.HandlerFunc(c.apiCalculateHandler)))
+	mux.Handle("/api/batch", withRequestID(http.HandlerFunc(c.apiBatchHandler)))
+	mux.HandleFunc("/memory", c.memoryHandler)
+
+	requests := []func(i int) *http.Request{
+		func(i int) *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/?expr="+url.QueryEscape(fmt.Sprintf("x = %d; x * 2 + ans", i)), nil)
+		},
+		func(i int) *http.Request {
+			body := fmt.Sprintf(`{"expression": "%d + 1", "steps": true}`, i%10)
+			return httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(body))
+		},
+		func(i int) *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(`{"expressions": ["1+1", "2^10", "1/0"]}`))
+			r.Header.Set("Idempotency-Key", fmt.Sprint("key", i%5))
+			return r
+		},
+		func(i int) *http.Request {
+			key := []string{"M+", "M-", "MC", "MR"}[i%4]
+			r := httptest.NewRequest(http.MethodPost, "/memory", strings.NewReader("key="+url.QueryEscape(key)))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			return r
+		},
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, requests[(g+i)%len(requests)](i))
+				if w.Code >= http.StatusInternalServerError {
+					t.Errorf("status %d: %s", w.Code, w.Body)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if entries := c.history.Entries(); len(entries) == 0 {
+		t.Error("no calculation from the form was recorded in the history")
+	}
+}
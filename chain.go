@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ChainStep is one operation of an /api/chain request. eval is the only
+// operation, evaluating Expr.
+type ChainStep struct {
+	Op   string `json:"op"`
+	Expr string `json:"expr"`
+}
+
+// ChainResult is the outcome of one step of an /api/chain request
+type ChainResult struct {
+	Expression string `json:"expression"`
+	Result     string `json:"result"`
+}
+
+// ChainResponse is the JSON body returned by /api/chain. Steps holds the
+// results of the steps evaluated, Result the last one, and a failing step
+// is reported by its index from 0 with its error.
+type ChainResponse struct {
+	Valid      bool          `json:"valid"`
+	Steps      []ChainResult `json:"steps"`
+	Result     string        `json:"result"`
+	Error      string        `json:"error,omitempty"`
+	FailedStep *int          `json:"failed_step,omitempty"`
+}
+
+// apiChainHandler evaluates a JSON list of steps in order, each able to use
+// ans and the variables of the steps before it. They are kept in a scope of
+// the request's own, so chains don't see the calculator's ans or each
+// other's. The first invalid step ends the chain.
+func (c *Calculator) apiChainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, ChainResponse{Error: "method not allowed, use POST"})
+		return
+	}
+
+	var steps []ChainStep
+	if status, err := decodeJSON(w, r, &steps); err != nil {
+		writeJSON(w, status, ChainResponse{Error: err.Error()})
+		return
+	}
+	if len(steps) > maxBatchSize {
+		writeJSON(w, http.StatusBadRequest, ChainResponse{Error: fmt.Sprintf("too many steps, the limit is %d", maxBatchSize)})
+		return
+	}
+	for i, step := range steps {
+		if step.Op != "eval" {
+			writeJSON(w, http.StatusBadRequest, ChainResponse{Error: fmt.Sprintf("step %d: unknown op %q, expected eval", i, step.Op)})
+			return
+		}
+	}
+
+	opts := baseOptions()
+	if err := parseSettings(&opts, r.URL.Query()); err != nil {
+		writeJSON(w, http.StatusBadRequest, ChainResponse{Error: err.Error()})
+		return
+	}
+
+	scope := NewScope()
+	resp := ChainResponse{Steps: make([]ChainResult, 0, len(steps))}
+	for i, step := range steps {
+		opts.Vars = scope.Vars()
+
+		result, err := c.safeCalculate(r.Context(), step.Expr, opts)
+		if err != nil {
+			resp.Error = err.Error()
+			resp.FailedStep = &i
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+
+		scope.Store(result)
+		resp.Steps = append(resp.Steps, ChainResult{Expression: step.Expr, Result: result.Text})
+		resp.Result = result.Text
+	}
+
+	resp.Valid = true
+	writeJSON(w, http.StatusOK, resp)
+}
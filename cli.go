@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// cliMode reports whether the program should evaluate expressions from the
+// command line or stdin rather than serve the web form. Stdin is only read
+// when it is piped and -addr wasn't given.
+func cliMode(expr string) bool {
+	if expr != "" || flag.NArg() > 0 {
+		return true
+	}
+
+	addrSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "addr" {
+			addrSet = true
+		}
+	})
+	if addrSet {
+		return false
+	}
+
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&(os.ModeNamedPipe|os.ModeCharDevice) == os.ModeNamedPipe
+}
+
+// runCLI evaluates the -e expression and the arguments, or each line of
+// stdin when there are none, printing one result per line, or their tokens
+// with -tokens. Comments are stripped, and blank and comment only lines
+// skipped. It returns the exit code, which is 1 if any expression was
+// invalid.
+func (c *Calculator) runCLI(expr string) int {
+	// Results go to stdout, so don't also log them
+	*quiet = true
+
+	var lines []string
+	if expr != "" {
+		lines = append(lines, expr)
+	}
+	lines = append(lines, flag.Args()...)
+	if len(lines) == 0 {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, "failed to read stdin:", err)
+			return 1
+		}
+	}
+
+	var exprs []string
+	for _, line := range lines {
+		if line = stripComment(line); line != "" {
+			exprs = append(exprs, line)
+		}
+	}
+
+	if *dumpTokens {
+		return printTokens(exprs, os.Stdout, os.Stderr)
+	}
+	return c.evaluateAll(exprs, os.Stdout, os.Stderr)
+}
+
+// stripComment removes a comment, from '#' to the end of the line, and the
+// surrounding spaces, eg. 2 + 3 # total items is 2 + 3. No expression
+// contains '#', so any starts a comment.
+func stripComment(line string) string {
+	line, _, _ = strings.Cut(line, "#")
+	return strings.TrimSpace(line)
+}
+
+// printTokens writes the tokens of each expression, or of the value of an
+// assignment, space separated on one line without evaluating it. Tokens are
+// printed even if the expression then fails validation, and only a failure
+// to tokenize is an error.
+func printTokens(exprs []string, out, errOut io.Writer) int {
+	code := 0
+	for _, expr := range exprs {
+		tokens, _, err := parseTree(expr, baseOptions())
+		if tokens == nil && err != nil {
+			fmt.Fprintf(errOut, "%s: %s\n", expr, err)
+			code = 1
+			continue
+		}
+		fmt.Fprintln(out, strings.Join(tokens, " "))
+	}
+
+	return code
+}
+
+// evaluateAll evaluates the expressions in order, so later ones can use ans
+// and variables assigned by earlier ones. Results are written to out and
+// errors to errOut.
+func (c *Calculator) evaluateAll(exprs []string, out, errOut io.Writer) int {
+	code := 0
+	for _, expr := range exprs {
+		if !c.evaluateLine(expr, out, errOut) {
+			code = 1
+		}
+	}
+
+	return code
+}
+
+// evaluateLine evaluates one expression with the scope's ans, variables and
+// memory, writing its result to out or its error to errOut, and reports
+// whether it was valid
+func (c *Calculator) evaluateLine(expr string, out, errOut io.Writer) bool {
+	opts := baseOptions()
+	opts.Vars = c.scope.Vars()
+
+	isValid, result := c.performArithmeticCalculation(context.Background(), expr, opts)
+	if !isValid {
+		message := strings.TrimPrefix(result.Text, "Error: ")
+		if message == "" {
+			message = "invalid expression"
+		}
+		fmt.Fprintf(errOut, "%s: %s\n", expr, message)
+		return false
+	}
+
+	c.scope.Store(result)
+	fmt.Fprintln(out, result.Text)
+	return true
+}
+
+// runREPL evaluates the lines of in one at a time until EOF or a quit or
+// exit line, keeping ans, variables and the memory across lines. M+, M- and
+// MC operate the memory as the web form's keys do, and MR recalls it.
+// Comments are stripped as in scripts. The prompt is written before each
+// line when prompt is set. Errors don't end the session.
+func (c *Calculator) runREPL(in io.Reader, out, errOut io.Writer, prompt bool) int {
+	// Results go to out, so don't also log them
+	*quiet = true
+
+	scanner := bufio.NewScanner(in)
+	for {
+		if prompt {
+			fmt.Fprint(out, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+
+		switch line := stripComment(scanner.Text()); line {
+		case "":
+		case "quit", "exit":
+			return 0
+		case "M+", "M-":
+			sign := 1.0
+			if line == "M-" {
+				sign = -1
+			}
+			if !c.scope.AddToMemory(sign) {
+				fmt.Fprintln(errOut, "no previous result for", line)
+			}
+		case "MC":
+			c.scope.ClearMemory()
+		default:
+			c.evaluateLine(line, out, errOut)
+		}
+	}
+
+	if prompt {
+		fmt.Fprintln(out)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(errOut, "failed to read stdin:", err)
+		return 1
+	}
+	return 0
+}
+
+// isTerminal reports whether f is a terminal rather than a pipe or file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
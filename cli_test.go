@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStripComment(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{line: "2 + 3", want: "2 + 3"},
+		{line: "2 + 3  # total items", want: "2 + 3"},
+		{line: "2 + 3#", want: "2 + 3"},
+		{line: "# a whole line", want: ""},
+		{line: "   # indented", want: ""},
+		{line: "1 # one # two", want: "1"},
+		{line: "", want: ""},
+	}
+	for _, tc := range tests {
+		if got := stripComment(tc.line); got != tc.want {
+			t.Errorf("%q: %q, want %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestREPLComments(t *testing.T) {
+	script := strings.Join([]string{
+		"# prices",
+		"x = 4  # apples",
+		"",
+		"   # nothing here",
+		"x * 2 # doubled",
+		"ans + 1",
+		"1 +   # missing operand",
+	}, "\n")
+
+	var out, errOut bytes.Buffer
+	c := newTestCalculator()
+	if code := c.runREPL(strings.NewReader(script), &out, &errOut, false); code != 0 {
+		t.Errorf("exit code %d", code)
+	}
+	if want := "4\n8\n9\n"; out.String() != want {
+		t.Errorf("output %q, want %q", out.String(), want)
+	}
+	if want := "1 +: invalid expression at position 4\n"; errOut.String() != want {
+		t.Errorf("errors %q, want %q", errOut.String(), want)
+	}
+}
+
+func TestBatchComments(t *testing.T) {
+	c := newTestCalculator()
+	w := postJSON(t, c.apiBatchHandler, "/api/batch", BatchRequest{Expressions: []string{
+		"# header",
+		"2 + 3  # total items",
+		"",
+		"7 * 6",
+	}})
+
+	var results []BatchResult
+	decodeResponse(t, w, &results)
+	want := []struct{ expr, result string }{
+		{"2 + 3  # total items", "5"},
+		{"", ""},
+		{"7 * 6", "42"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("%d results %+v, want %d", len(results), results, len(want))
+	}
+	for i, result := range results {
+		if result.Expression != want[i].expr || result.Result != want[i].result {
+			t.Errorf("result %d: %q = %q (%s), want %q = %q", i, result.Expression, result.Result, result.Error, want[i].expr, want[i].result)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// CORS lets browser apps on other origins call the JSON API. Only the
+// allowed origins, or every origin with "*", receive the headers.
+type CORS struct {
+	origins []string
+}
+
+// NewCORS returns a policy allowing a comma separated list of origins, such
+// as https://app.example.com, or "*" for any. An empty list allows none, so
+// only same-origin pages can read the responses.
+func NewCORS(list string) *CORS {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return &CORS{origins: origins}
+}
+
+// allowedOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" if the origin isn't allowed
+func (c *CORS) allowedOrigin(origin string) string {
+	switch {
+	case slices.Contains(c.origins, "*"):
+		return "*"
+	case origin != "" && slices.Contains(c.origins, origin):
+		return origin
+	}
+	return ""
+}
+
+// Wrap adds the CORS headers to next's responses, and answers preflight
+// OPTIONS requests itself
+func (c *CORS) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the origin unless every origin is allowed
+		if !slices.Contains(c.origins, "*") {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		allowed := c.allowedOrigin(r.Header.Get("Origin"))
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, Idempotent-Replayed")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed != "" {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key, X-Request-ID")
+				w.Header().Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		allow   string
+		origin  string
+		allowed string
+	}{
+		{allow: "", origin: "https://app.example.com", allowed: ""},
+		{allow: "https://app.example.com", origin: "https://app.example.com", allowed: "https://app.example.com"},
+		{allow: "https://a.example.com, https://app.example.com/", origin: "https://app.example.com", allowed: "https://app.example.com"},
+		{allow: "https://app.example.com", origin: "https://evil.example.com", allowed: ""},
+		{allow: "*", origin: "https://evil.example.com", allowed: "*"},
+	}
+
+	c := newTestCalculator()
+	for _, tc := range tests {
+		h := NewCORS(tc.allow).Wrap(http.HandlerFunc(c.apiCalculateHandler))
+		r := httptest.NewRequest(http.MethodOptions, "/api/calculate", nil)
+		r.Header.Set("Origin", tc.origin)
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		r.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if w.Code != http.StatusNoContent {
+			t.Errorf("%q from %s: status %d, want 204", tc.allow, tc.origin, w.Code)
+		}
+		header := w.Header()
+		if got := header.Get("Access-Control-Allow-Origin"); got != tc.allowed {
+			t.Errorf("%q from %s: allowed origin %q, want %q", tc.allow, tc.origin, got, tc.allowed)
+		}
+		if tc.allowed == "" {
+			if got := header.Get("Access-Control-Allow-Methods"); got != "" {
+				t.Errorf("%q from %s: methods %q for a disallowed origin", tc.allow, tc.origin, got)
+			}
+			continue
+		}
+		if got := header.Get("Access-Control-Allow-Methods"); !strings.Contains(got, "POST") {
+			t.Errorf("%q from %s: methods %q, want POST", tc.allow, tc.origin, got)
+		}
+		if got := header.Get("Access-Control-Allow-Headers"); !strings.Contains(got, "Content-Type") {
+			t.Errorf("%q from %s: headers %q, want Content-Type", tc.allow, tc.origin, got)
+		}
+		if vary := header.Get("Vary"); (tc.allowed == "*") != (vary == "") {
+			t.Errorf("%q from %s: Vary %q", tc.allow, tc.origin, vary)
+		}
+	}
+}
+
+func TestCORSRequest(t *testing.T) {
+	c := newTestCalculator()
+	h := NewCORS("https://app.example.com").Wrap(http.HandlerFunc(c.apiCalculateHandler))
+	r := httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(`{"expression": "1+2"}`))
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("allowed origin %q", got)
+	}
+	if !strings.Contains(w.Body.String(), `"result":"3"`) {
+		t.Errorf("response %s isn't the calculation", w.Body)
+	}
+}
+
+func TestCORSDefault(t *testing.T) {
+	// No origin is allowed unless configured, so * must be chosen explicitly
+	if *corsOrigins != "" {
+		t.Fatalf("-cors-origins defaults to %q", *corsOrigins)
+	}
+	if got := NewCORS(*corsOrigins).allowedOrigin("https://app.example.com"); got != "" {
+		t.Errorf("the default policy allows %q", got)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// csvHandler evaluates an expression template against every row of an
+// uploaded CSV file. Columns are referenced by header name, eg. price * quantity,
+// and the file is returned with result and error columns appended.
+func csvHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "missing CSV file upload", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		http.Error(w, "failed to read CSV header", http.StatusBadRequest)
+		return
+	}
+
+	// Map each header name to its column index
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+
+	if err := checkLength(r.FormValue("expression")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := baseOptions()
+	original := r.FormValue("expression")
+	expr, err := calc.Preprocess(original, calc.PreprocessorsFor(opts))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Every name in the expression must be a column
+	isColumn := func(token string) bool {
+		_, exists := columns[token]
+		return exists
+	}
+	tokens, err := checkTemplate(expr, opts, isColumn)
+	if err != nil {
+		// Report positions in the expression as given, not as preprocessed
+		http.Error(w, calc.InOriginal(err, original, expr, opts).Error(), http.StatusBadRequest)
+		return
+	}
+	tree := calc.BuildTree(tokens)
+
+	w.Header().Set("Content-Type", "text/csv")
+	out := csv.NewWriter(w)
+	out.Write(append(header, "result", "error"))
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			out.Write([]string{"", "", err.Error()})
+			break
+		}
+
+		// Pad a short row so its result and error line up with the header
+		row := record
+		if len(row) < len(header) {
+			row = append(row, make([]string, len(header)-len(row))...)
+		}
+
+		result, err := evaluateRow(tree, columns, record)
+		if err != nil {
+			out.Write(append(row, "", err.Error()))
+		} else {
+			out.Write(append(row, result, ""))
+		}
+	}
+
+	out.Flush()
+}
+
+// checkTemplate validates the preprocessed expression template, with names
+// allowed by isColumn, and tokenizes it
+func checkTemplate(expr string, opts calc.Options, isColumn func(string) bool) ([]string, error) {
+	if err := calc.CheckDepth(expr, opts.MaxDepth); err != nil {
+		return nil, err
+	}
+	if err := calc.CheckParens(expr); err != nil {
+		return nil, err
+	}
+	if err := calc.ValidateNames(expr, isColumn); err != nil {
+		return nil, err
+	}
+	return calc.Tokenize(expr)
+}
+
+// evaluateRow evaluates the tree with column names bound to the row's cells
+func evaluateRow(tree *calc.Node, columns map[string]int, record []string) (string, error) {
+	vars := make(map[string]float64)
+	for name, i := range columns {
+		if i >= len(record) {
+			continue
+		}
+		if val, err := strconv.ParseFloat(strings.TrimSpace(record[i]), 64); err == nil {
+			vars[name] = val
+		}
+	}
+
+	bound, err := bindTree(tree, vars, columns, record)
+	if err != nil {
+		return "", err
+	}
+
+	result, err := calc.EvalTree(bound, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := calc.CheckFinite(result); err != nil {
+		return "", err
+	}
+
+	return calc.FormatFloat(result, calc.DefaultPrecision, calc.RoundHalfAwayFromZero), nil
+}
+
+// bindTree returns a copy of the tree with every column reference replaced
+// by the row's numeric value, reporting missing and non-numeric cells
+func bindTree(node *calc.Node, vars map[string]float64, columns map[string]int, record []string) (*calc.Node, error) {
+	if node == nil {
+		return nil, nil
+	}
+
+	if node.IsCall() {
+		args := make([]*calc.Node, len(node.Args))
+		for i, arg := range node.Args {
+			bound, err := bindTree(arg, vars, columns, record)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = bound
+		}
+		return &calc.Node{Value: node.Value, Args: args}, nil
+	}
+
+	// Column names start with a letter, unlike numbers such as 0xFF
+	if name := node.Value; node.Left == nil && node.Right == nil && unicode.IsLetter([]rune(name)[0]) {
+		val, exists := vars[name]
+		if !exists {
+			if columns[name] >= len(record) {
+				return nil, fmt.Errorf("missing value for column %q", name)
+			}
+			return nil, fmt.Errorf("non-numeric value %q in column %q", record[columns[name]], name)
+		}
+		return &calc.Node{Value: strconv.FormatFloat(val, 'g', -1, 64)}, nil
+	}
+
+	left, err := bindTree(node.Left, vars, columns, record)
+	if err != nil {
+		return nil, err
+	}
+	right, err := bindTree(node.Right, vars, columns, record)
+	if err != nil {
+		return nil, err
+	}
+
+	return &calc.Node{Value: node.Value, Left: left, Right: right}, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+// postCSV uploads data to the CSV endpoint with the expression and returns
+// the recorded response
+func postCSV(t *testing.T, expr, data string) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("expression", expr)
+	file, err := form.CreateFormFile("file", "data.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte(data))
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/api/csv", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	csvHandler(w, r)
+	return w
+}
+
+func TestCSV(t *testing.T) {
+	data := "item,price,quantity\n" +
+		"apple,0.5,4\n" +
+		"pear,1.25,2\n" +
+		"plum,n/a,3\n" +
+		"fig,2\n"
+	w := postCSV(t, "-price * quantity + 1", data)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"item", "price", "quantity", "result", "error"},
+		{"apple", "0.5", "4", "-1", ""},
+		{"pear", "1.25", "2", "-1.5", ""},
+		{"plum", "n/a", "3", "", `non-numeric value "n/a" in column "price"`},
+		{"fig", "2", "", "", `missing value for column "quantity"`},
+	}
+	for i, record := range records {
+		if i >= len(want) || !slices.Equal(record, want[i]) {
+			t.Errorf("row %d: %q", i, record)
+		}
+	}
+	if len(records) != len(want) {
+		t.Errorf("%d rows, want %d", len(records), len(want))
+	}
+}
+
+func TestCSVRejected(t *testing.T) {
+	tests := []struct {
+		expr string
+		data string
+		err  string
+	}{
+		{expr: "price * count", data: "price,quantity\n1,2\n", err: "unknown name: count at position 9\n"},
+		{expr: "price * (quantity", data: "price,quantity\n1,2\n", err: "unbalanced parentheses at position 9\n"},
+		{expr: "price * quantity", data: "", err: "failed to read CSV header\n"},
+	}
+	for _, tc := range tests {
+		w := postCSV(t, tc.expr, tc.data)
+		if w.Code != http.StatusBadRequest || w.Body.String() != tc.err {
+			t.Errorf("%s: status %d %q, want 400 %q", tc.expr, w.Code, w.Body, tc.err)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// numberLocale is how numbers are written in a locale
+type numberLocale struct {
+	// decimalComma writes 1,5 for one and a half
+	decimalComma bool
+	// separator groups the digits of the integer part
+	separator string
+}
+
+// locales are the number formats selectable with the locale parameter
+var locales = map[string]numberLocale{
+	"en": {decimalComma: false, separator: ","},
+	"de": {decimalComma: true, separator: "."},
+	"es": {decimalComma: true, separator: "."},
+	"fr": {decimalComma: true, separator: " "},
+	"it": {decimalComma: true, separator: "."},
+	"nl": {decimalComma: true, separator: "."},
+	"pt": {decimalComma: true, separator: "."},
+	"ru": {decimalComma: true, separator: " "},
+}
+
+// parseLocale returns the number format of a locale parameter, where blank
+// means en
+func parseLocale(name string) (numberLocale, error) {
+	if name == "" {
+		return locales["en"], nil
+	}
+
+	locale, exists := locales[name]
+	if !exists {
+		return numberLocale{}, fmt.Errorf("unsupported locale %q", name)
+	}
+	return locale, nil
+}
+
+// point returns the decimal point of the locale
+func (l numberLocale) point() string {
+	if l.decimalComma {
+		return ","
+	}
+	return "."
+}
+
+// thousandsSeparators are the digit group separators selectable with the
+// sep query parameter
+var thousandsSeparators = map[string]string{
+	"comma":  ",",
+	"space":  " ",
+	"period": ".",
+}
+
+// parseSeparator returns the separator a sep query parameter selects, where
+// blank means the locale's own
+func parseSeparator(name string, locale numberLocale) (string, error) {
+	if name == "" {
+		return locale.separator, nil
+	}
+
+	sep, exists := thousandsSeparators[name]
+	if !exists {
+		return "", fmt.Errorf("unknown separator %q, use comma, space or period", name)
+	}
+	return sep, nil
+}
+
+// groupThousands inserts sep between every three digits of the integer part
+// of a plain decimal such as -1234567.89, writing point as its decimal point.
+// Anything else, such as a fraction, is returned unchanged.
+func groupThousands(number, sep, point string) string {
+	sign, digits := "", number
+	if strings.HasPrefix(digits, "-") {
+		sign, digits = "-", digits[1:]
+	}
+
+	integer, fraction, hasFraction := strings.Cut(digits, ".")
+	if integer == "" || strings.Trim(integer, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return number
+	}
+
+	var grouped strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			grouped.WriteString(sep)
+		}
+		grouped.WriteRune(digit)
+	}
+
+	if hasFraction {
+		return sign + grouped.String() + point + fraction
+	}
+	return sign + grouped.String()
+}
@@ -1,3 +1,3 @@
-module GoCalculate
+module github.com/GoCalculate/GoCalculate
 
 go 1.22.0
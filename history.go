@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// historySize is the number of recent calculations kept
+const historySize = 20
+
+// HistoryEntry is one submitted calculation
+type HistoryEntry struct {
+	Expression string `json:"expression"`
+	Result     string `json:"result"`
+	Valid      bool   `json:"valid"`
+}
+
+// History is a fixed-size ring buffer of recent calculations, safe for
+// concurrent use by request handlers. When path is set, the entries are
+// saved to it as JSON after every change.
+type History struct {
+	mu      sync.Mutex
+	entries []HistoryEntry
+	next    int
+	full    bool
+	path    string
+}
+
+// NewHistory returns an empty history holding up to size entries
+func NewHistory(size int) *History {
+	return &History{entries: make([]HistoryEntry, size)}
+}
+
+// LoadHistory returns a history persisted to path, starting with the entries
+// saved there. A missing file starts an empty history, as does a corrupt or
+// unreadable one after logging a warning.
+func LoadHistory(path string, size int) *History {
+	h := NewHistory(size)
+	h.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h
+	}
+	if err != nil {
+		log.Printf("warning: could not read history file %s, starting empty: %v", path, err)
+		return h
+	}
+
+	var entries []HistoryEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.Printf("warning: history file %s is corrupt, starting empty: %v", path, err)
+		return h
+	}
+
+	// Keep only the newest entries that fit
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+	for _, entry := range entries {
+		h.add(entry)
+	}
+	return h
+}
+
+// Add records a calculation, overwriting the oldest once the buffer is full
+func (h *History) Add(entry HistoryEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.add(entry)
+	h.save()
+}
+
+// add records an entry without locking or saving
+func (h *History) add(entry HistoryEntry) {
+	h.entries[h.next] = entry
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// Entries returns the recorded calculations, newest first
+func (h *History) Entries() []HistoryEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.newestFirst()
+}
+
+// newestFirst lists the entries without locking
+func (h *History) newestFirst() []HistoryEntry {
+	count := h.next
+	if h.full {
+		count = len(h.entries)
+	}
+
+	entries := make([]HistoryEntry, 0, count)
+	for i := 1; i <= count; i++ {
+		entries = append(entries, h.entries[(h.next-i+len(h.entries))%len(h.entries)])
+	}
+	return entries
+}
+
+// Clear removes every entry
+func (h *History) Clear() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clear(h.entries)
+	h.next = 0
+	h.full = false
+	h.save()
+}
+
+// save writes the entries to the history file, oldest first, without
+// locking. The file is replaced atomically so a crash can't leave it half
+// written.
+func (h *History) save() {
+	if h.path == "" {
+		return
+	}
+
+	entries := h.newestFirst()
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		log.Printf("could not encode history: %v", err)
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(h.path), ".history-*.json")
+	if err != nil {
+		log.Printf("could not save history: %v", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		log.Printf("could not save history: %v", err)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		log.Printf("could not save history: %v", err)
+		return
+	}
+	if err := os.Rename(tmp.Name(), h.path); err != nil {
+		log.Printf("could not save history: %v", err)
+	}
+}
+
+// clearHistoryHandler empties the history and returns to the form
+func (c *Calculator) clearHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	c.history.Clear()
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+const (
+	// maxIdempotencyKeys bounds the number of batch responses remembered
+	maxIdempotencyKeys = 10000
+	// maxIdempotencyBytes bounds the total size of the batch responses
+	// remembered, as a single response can be megabytes
+	maxIdempotencyBytes = 64 << 20
+	// idempotencyTTL is how long a batch response is replayed for its key
+	idempotencyTTL = 24 * time.Hour
+)
+
+// RequestHash identifies a request body and settings by their SHA-256, so
+// a retry can be told from a different request without keeping the request
+type RequestHash [sha256.Size]byte
+
+// IdempotencyStore remembers batch responses by the client's Idempotency-Key
+// for a while, so a retried request gets the same response without being
+// evaluated again. It holds up to a number of responses and of bytes, and is
+// safe for concurrent use.
+type IdempotencyStore struct {
+	mu       sync.Mutex
+	size     int
+	maxBytes int
+	bytes    int
+	ttl      time.Duration
+	order    *list.List
+	entries  map[string]*list.Element
+	now      func() time.Time
+}
+
+// storedResponse is one remembered batch response, the JSON body sent
+type storedResponse struct {
+	key     string
+	request RequestHash
+	body    []byte
+	expires time.Time
+}
+
+// cost is the number of bytes the response counts for against the store's
+// limit
+func (r *storedResponse) cost() int {
+	return len(r.key) + len(r.body)
+}
+
+// NewIdempotencyStore returns an empty store holding up to size responses
+// of maxBytes in total, each for ttl
+func NewIdempotencyStore(size, maxBytes int, ttl time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		size:     size,
+		maxBytes: maxBytes,
+		ttl:      ttl,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+		now:      time.Now,
+	}
+}
+
+// Get returns the response remembered for key and whether there is one. A
+// response remembered for a different request is reported with ok false and
+// conflict true.
+func (s *IdempotencyStore) Get(key string, request RequestHash) (body []byte, ok, conflict bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	elem, exists := s.entries[key]
+	if !exists {
+		return nil, false, false
+	}
+
+	entry := elem.Value.(*storedResponse)
+	if entry.request != request {
+		return nil, false, true
+	}
+	return entry.body, true, false
+}
+
+// Put remembers the response body to request for key, forgetting the
+// oldest responses to make room. A response already remembered for key is
+// kept, so a retry racing the original can't replace it, and one larger
+// than the whole store isn't remembered.
+func (s *IdempotencyStore) Put(key string, request RequestHash, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	entry := &storedResponse{key: key, request: request, body: body, expires: s.now().Add(s.ttl)}
+	if _, exists := s.entries[key]; exists || s.size <= 0 || entry.cost() > s.maxBytes {
+		return
+	}
+
+	for s.order.Len() >= s.size || s.bytes+entry.cost() > s.maxBytes {
+		s.remove(s.order.Front())
+	}
+	s.entries[key] = s.order.PushBack(entry)
+	s.bytes += entry.cost()
+}
+
+// expire forgets the responses past their TTL. Every response is kept for
+// the same TTL, so they expire in the order they were stored.
+func (s *IdempotencyStore) expire() {
+	now := s.now()
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		if now.Before(elem.Value.(*storedResponse).expires) {
+			return
+		}
+		s.remove(elem)
+	}
+}
+
+// remove forgets a stored response
+func (s *IdempotencyStore) remove(elem *list.Element) {
+	entry := elem.Value.(*storedResponse)
+	s.order.Remove(elem)
+	delete(s.entries, entry.key)
+	s.bytes -= entry.cost()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// postBatch sends a batch request with an Idempotency-Key to the handler
+func postBatch(c *Calculator, key, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/batch", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	c.apiBatchHandler(w, r)
+	return w
+}
+
+func TestBatchIdempotencyReplay(t *testing.T) {
+	c := newTestCalculator()
+	first := postBatch(c, "abc", `{"expressions": ["1+1", "rand()"]}`)
+	if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request: status %d, replayed %q", first.Code, first.Header().Get("Idempotent-Replayed"))
+	}
+
+	// rand() returns a different number each time, so an identical body
+	// shows the response was replayed rather than evaluated again
+	retry := postBatch(c, "abc", `{"expressions": ["1+1", "rand()"]}`)
+	if retry.Code != http.StatusOK || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: status %d, replayed %q", retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("retry body %s, want %s", retry.Body, first.Body)
+	}
+
+	other := postBatch(c, "def", `{"expressions": ["1+1", "rand()"]}`)
+	if other.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("a different key was replayed")
+	}
+}
+
+func TestBatchIdempotencyConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		body   string
+	}{
+		{name: "expressions", target: "/api/batch", body: `{"expressions": ["1+2"]}`},
+		{name: "settings", target: "/api/batch?precision=2", body: `{"expressions": ["1+1"]}`},
+	}
+
+	for _, tc := range tests {
+		c := newTestCalculator()
+		postBatch(c, "abc", `{"expressions": ["1+1"]}`)
+
+		r := httptest.NewRequest(http.MethodPost, tc.target, strings.NewReader(tc.body))
+		r.Header.Set("Idempotency-Key", "abc")
+		w := httptest.NewRecorder()
+		c.apiBatchHandler(w, r)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status %d, want %d for a key reused with a different request", tc.name, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+}
+
+func TestIdempotencyStoreLimits(t *testing.T) {
+	hash := func(s string) RequestHash { return sha256.Sum256([]byte(s)) }
+	body := []byte(strings.Repeat("x", 100))
+
+	// The oldest responses are forgotten to stay within the byte limit
+	s := NewIdempotencyStore(10, 250, time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		s.Put(key, hash(key), body)
+	}
+	if _, ok, _ := s.Get("a", hash("a")); ok {
+		t.Error("the oldest response was kept beyond the byte limit")
+	}
+	for _, key := range []string{"b", "c"} {
+		if _, ok, _ := s.Get(key, hash(key)); !ok {
+			t.Errorf("response %s was forgotten", key)
+		}
+	}
+
+	// A response larger than the whole store isn't kept
+	s.Put("big", hash("big"), make([]byte, 300))
+	if _, ok, _ := s.Get("big", hash("big")); ok {
+		t.Error("a response larger than the store was kept")
+	}
+
+	// The number of responses is bounded too
+	s = NewIdempotencyStore(2, 1<<20, time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		s.Put(key, hash(key), body)
+	}
+	if _, ok, _ := s.Get("a", hash("a")); ok {
+		t.Error("the oldest response was kept beyond the key limit")
+	}
+
+	// Responses expire after the TTL
+	now := time.Now()
+	s = NewIdempotencyStore(10, 1<<20, time.Hour)
+	s.now = func() time.Time { return now }
+	s.Put("a", hash("a"), body)
+	now = now.Add(2 * time.Hour)
+	if _, ok, _ := s.Get("a", hash("a")); ok {
+		t.Error("a response was replayed after its TTL")
+	}
+	if s.bytes != 0 {
+		t.Errorf("%d bytes counted after every response expired", s.bytes)
+	}
+}
@@ -1,65 +1,223 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"go/parser"
 	"html/template"
+	"log"
+	"log/slog"
 	"math"
 	"net/http"
-	"regexp"
+	"net/url"
+	"os"
+	"os/signal"
 	"strconv"
 	"strings"
-	"unicode"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/GoCalculate/GoCalculate/calc"
 )
 
 type PageVariables struct {
 	ArithmeticEquation string
 	IsValid            bool
 	Result             string
+	ResultDecimal      string
+	ResultScientific   string
+	ResultFraction     string
+	PreferScientific   bool
+	Engineering        bool
+	MaxLength          int
+	Memory             string
+	ErrorMarker        string
+	Physics            bool
+	Decimal            bool
+	Exact              bool
+	Fractions          bool
+	Percent            bool
+	Complex            bool
+	ExactDigits        string
+	Precision          string
+	SigFigs            string
+	Rounding           string
+	Angle              calc.AngleMode
+	Locale             string
+	ShowSteps          bool
+	Partial            bool
+	Steps              []string
+	ShowTree           bool
+	Tree               string
+	ShowProvenance     bool
+	Provenance         string
+	History            []HistoryEntry
 }
 
-// Node represents a binary tree node for an expression
-type Node struct {
-	Value string
-	Left  *Node
-	Right *Node
-}
+// Name of the cookie remembering the last submitted expression
+const lastExpressionCookie = "last_expression"
+
+var (
+	addr          = flag.String("addr", defaultAddr(), "address to listen on, eg. :8011 or 127.0.0.1:8011 (defaults to $PORT if set)")
+	autosave      = flag.Bool("autosave", true, "remember the last submitted expression in a cookie")
+	invalidStatus = flag.Bool("invalid-422", false, "respond with HTTP 422 when a submitted expression is invalid")
+	decimalScale  = flag.Int("decimal-scale", calc.DefaultScale, "number of fractional digits kept in decimal mode")
+	maxDepth      = flag.Int("max-depth", calc.DefaultMaxDepth, "deepest parenthesis nesting accepted in expressions")
+	maxLength     = flag.Int("max-length", 1000, "longest expression accepted, in characters")
+	historyFile   = flag.String("history", "history.json", "file the calculation history is saved to, or empty to keep it in memory only")
+	evalTimeout   = flag.Duration("timeout", time.Second, "longest a single calculation may run")
+	rateLimit     = flag.Float64("rate", 10, "requests per second allowed per client IP on the calculator endpoints, or 0 for no limit")
+	rateBurst     = flag.Int("burst", 20, "requests a client IP may make in a burst above -rate")
+	proxies       = flag.String("trusted-proxies", "", "comma separated proxy IPs or CIDR ranges whose X-Forwarded-For header is trusted")
+	logLevel      = flag.String("log-level", "info", "minimum level logged: debug, info, warn or error")
+	quiet         = flag.Bool("quiet", false, "don't log each calculation")
+	lenientSeps   = flag.Bool("lenient-separators", false, "ignore a single trailing ';' or ',' in expressions and argument lists, eg. 1+1; or max(1, 2,)")
+	cacheSize     = flag.Int("cache-size", 1024, "number of recent calculation results remembered, or 0 to disable the cache")
+	expression    = flag.String("e", "", "evaluate an expression and print the result instead of serving the web form")
+	dumpTokens    = flag.Bool("tokens", false, "print the tokens of each expression given on the command line or stdin instead of evaluating it")
+	repl          = flag.Bool("repl", false, "evaluate expressions typed on stdin one line at a time, keeping ans, variables and the memory, until quit or exit")
+	shutdownGrace = flag.Duration("shutdown-timeout", 10*time.Second, "longest to wait for in-flight requests when shutting down")
+	corsOrigins   = flag.String("cors-origins", "", "comma separated origins allowed to call the /api/ endpoints from a browser, or * for any")
+	seed          = flag.Int64("seed", 0, "seed for random and rand, for reproducible results, or 0 to seed from the clock")
+	sciAbove      = flag.Float64("sci-above", 1e15, "magnitude from which results are shown in scientific notation on the web form")
+	sciBelow      = flag.Float64("sci-below", 1e-4, "magnitude below which nonzero results are shown in scientific notation on the web form")
+	displayLimit  = flag.Float64("display-limit", 1e100, "magnitude above which results aren't shown on the web form, as too large to be meaningful")
+	aliasList     = flag.String("aliases", "", "comma separated pairs of a character and the operator it is read as, eg. :/ to read : as division")
+	notation      = flag.String("notation", "scientific", "notation for large and small results on the web form: scientific, or engineering for exponents that are multiples of 3")
+)
 
 func main() {
+	flag.Parse()
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(*logLevel)); err != nil {
+		log.Fatalf("invalid -log-level: %v", err)
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	if *seed != 0 {
+		calc.Seed(*seed)
+	}
+
+	var err error
+	if aliases, err = parseAliases(*aliasList); err != nil {
+		log.Fatalf("invalid -aliases: %v", err)
+	}
+
+	if *notation != "scientific" && *notation != "engineering" {
+		log.Fatalf("invalid -notation %q, use scientific or engineering", *notation)
+	}
+	if !(*sciBelow >= 0 && *sciBelow < *sciAbove) {
+		log.Fatal("-sci-below must be at least 0 and less than -sci-above")
+	}
+	if !(*displayLimit >= *sciAbove) {
+		log.Fatal("-display-limit must be at least -sci-above")
+	}
+
+	// Evaluate from the command line or stdin instead of serving
+	if *repl {
+		os.Exit(NewCalculator(NewHistory(historySize), *cacheSize).runREPL(os.Stdin, os.Stdout, os.Stderr, isTerminal(os.Stdin)))
+	}
+	if cliMode(*expression) {
+		os.Exit(NewCalculator(NewHistory(historySize), *cacheSize).runCLI(*expression))
+	}
+
+	history := NewHistory(historySize)
+	if *historyFile != "" {
+		history = LoadHistory(*historyFile, historySize)
+	}
+	c := NewCalculator(history, *cacheSize)
+
+	// Rate limit the calculator endpoints
+	limit := func(h http.HandlerFunc) http.Handler { return h }
+	if *rateLimit > 0 {
+		trusted, err := ParseTrustedProxies(*proxies)
+		if err != nil {
+			log.Fatalf("invalid -trusted-proxies: %v", err)
+		}
+		limiter := NewRateLimiter(*rateLimit, *rateBurst, trusted)
+		limit = func(h http.HandlerFunc) http.Handler { return limiter.Wrap(h) }
+	}
+
+	// Only the JSON API is shared with other origins, and its requests are
+	// given IDs to find them in the log
+	cors := NewCORS(*corsOrigins)
+	api := func(h http.HandlerFunc) http.Handler { return withRequestID(cors.Wrap(limit(h))) }
+
 	// Handle the root URL
-	http.HandleFunc("/", calculatorHandler)
+	http.Handle("/", limit(c.calculatorHandler))
+	http.Handle("/api/calculate", api(c.apiCalculateHandler))
+	http.Handle("/api/batch", api(c.apiBatchHandler))
+	http.Handle("/api/chain", api(c.apiChainHandler))
+	http.Handle("/api/csv", api(csvHandler))
+	http.Handle("/api/ast", api(apiASTHandler))
+	http.Handle("/api/series", api(apiSeriesHandler))
+	http.Handle("/api/validate", api(apiValidateHandler))
+	http.HandleFunc("/clear", c.clearHistoryHandler)
+	http.HandleFunc("/reset", c.resetHandler)
+	http.HandleFunc("/memory", c.memoryHandler)
+	http.HandleFunc("/health", healthHandler)
+	http.HandleFunc("/metrics", c.metricsHandler)
 
 	// Start the server
-	fmt.Println("Server started at http://localhost:8010")
-	http.ListenAndServe(":8011", nil)
+	fmt.Println("Server started at " + serverURL(*addr))
+	if err := serve(&http.Server{Addr: *addr}, *shutdownGrace); err != nil {
+		log.Fatal(err)
+	}
 }
 
-// Calculator handler for the web form
-func calculatorHandler(w http.ResponseWriter, r *http.Request) {
-	// Set initial values for the page
-	pageVariables := PageVariables{
-		ArithmeticEquation: "",
-		IsValid:            false,
-		Result:             "",
+// serve runs the server until SIGINT or SIGTERM, then stops accepting
+// connections and waits up to grace for in-flight requests to finish, so
+// their history entries are saved
+func serve(server *http.Server, grace time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errs := make(chan error, 1)
+	go func() { errs <- server.ListenAndServe() }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
 	}
 
-	// If the form was submitted
-	if r.Method == http.MethodPost {
-		// Parse form data
-		r.ParseForm()
-		arithEq := r.FormValue("arithmetic_equation")
+	// A second signal kills the process straight away
+	stop()
+	slog.Info("shutting down", "grace", grace)
 
-		// Perform the calculation
-		isValid, result := performArithmeticCalculation(arithEq)
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
 
-		// Update the pageVariables with input values and result
-		pageVariables.Result = result
-		pageVariables.IsValid = isValid
-		pageVariables.ArithmeticEquation = arithEq
+	slog.Info("shutdown complete")
+	return nil
+}
+
+// defaultAddr listens on $PORT when set, for platforms that assign one
+func defaultAddr() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
 	}
+	return ":8011"
+}
 
-	// Render HTML template with variables
-	tmpl, err := template.New("calculator").Parse(`
+// serverURL returns the URL a listen address can be browsed at
+func serverURL(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "http://localhost" + addr
+	}
+	return "http://" + addr
+}
+
+// calculatorTemplate renders the web form. It is parsed once at startup, so
+// a broken template stops the server from starting.
+var calculatorTemplate = template.Must(template.New("calculator").Parse(`
 	<!DOCTYPE html>
 	<html>
 	<head>
@@ -83,234 +241,515 @@ func calculatorHandler(w http.ResponseWriter, r *http.Request) {
 		<h1>Arithmetic Calculator</h1>
 		<div id="rule">
 			<p>Rules: </p>
-			<p>1. Accept operation for Addition, Substraction, Multiplication, Division</p>
-			<p>2. Expression should only contain numbers, decimal point, +, -, *, /, (, )</p>
-			<p>3. Negative and decimal values are allowed to be entered directly, eg. -1+-2.1, 1.5/-2</p>
-			<p>4. Multiplication can be done as eg. 1*-2, 1(-2)</p>
+			<p>1. Accept operation for Addition, Substraction, Multiplication, Division, Floor division (//), Modulo, Exponentiation (^ or **)</p>
+			<p>2. Expression should only contain numbers, decimal point, names of letters, +, -, *, /, %, ^, !, (, ), the comparisons &lt;, &gt;, &lt;=, &gt;=, == and !=, the bitwise &amp;, |, &lt;&lt; and &gt;&gt;, | bars, , between arguments, ; between statements and = for assignment</p>
+			<p>3. Signed and decimal values are allowed to be entered directly, eg. -1+-2.1, 1.5/-2, 3*+2, .5, 5.</p>
+			<p>4. Multiplication can be done as eg. 1*-2, 1(-2), (1+2)(3+4), (1+2)3</p>
 			<p>5. Enter the expression as eg. 1 + ( 2.5 * 3 - ( 4 / 5.7 ) - 6.01 ) + 7</p>
+			<p>6. Functions: sqrt, sin, cos, tan, asin, acos, atan, sinh, cosh, tanh, ln, log, abs, floor, ceil, round, eg. 2sqrt(2), -abs(1-3). Angles are in {{if eq .Angle "deg"}}degrees{{else}}radians{{end}}</p>
+			<p>&nbsp;&nbsp;&nbsp;&nbsp;min, max, pow, atan2, gcd, lcm, nCr and nPr take arguments separated by commas, eg. max(3, 7, 2), pow(2, 10), gcd(12, 18), nCr(5, 2), round(3.14159, 2), atan2(1, -1). log(x) is base 10 and log(x, b) base b, eg. log(8, 2)</p>
+			<p>7. Constants: pi, e, eg. 2pi, e^2</p>
+			<p>8. Scientific notation: 1e3, 2.5E-4, 6.022e23</p>
+			<p>9. Factorial of a non-negative integer: 5!, 3! + 2</p>
+			<p>10. With physics constants enabled (SI units): c = 299792458 m/s, g = 9.80665 m/s², h = 6.62607015e-34 J·s,</p>
+			<p>&nbsp;&nbsp;&nbsp;&nbsp;G = 6.67430e-11 m³/(kg·s²), k = 1.380649e-23 J/K, eg. 2c, 0.5*g*3(3)</p>
+			<p>11. ans is your previous result, eg. ans * 2. It is an error before your first result</p>
+			<p>12. Variables: assign with x = 5, then use x * 2 + x. Names are letters only, and pi, e, ans and functions are reserved. Each browser keeps up to 100 of its own, forgotten after 30 minutes unused</p>
+			<p>13. Bitwise operators on integers: &amp;, |, &lt;&lt;, &gt;&gt; and xor(a, b), binding looser than + and -, eg. 6 &amp; 3, 1 &lt;&lt; 4</p>
+			<p>14. With a decimal comma locale, write 1,5 for one and a half and separate function arguments with ;, eg. max(1,5; 2)</p>
+			<p>15. With percent enabled, a % not followed by a number, name or ( is a percentage: 50% is 0.5, 200 + 10% is 220, 200 * 10% is 20</p>
+			<p>16. With complex enabled, i is the imaginary unit, eg. (1+2i)*(3-i), sqrt(-1), e^(pi*i)</p>
+			<p>17. Comparisons &lt;, &gt;, &lt;=, &gt;=, == and != give 1 for true and 0 for false, binding loosest, eg. 1 + 1 == 2. Use parentheses to combine them, eg. (1 &lt; 2) == (3 &lt; 4)</p>
+			<p>18. Integers can be written in hexadecimal, octal or binary: 0xFF, 0o17 and 0b1010. These literals have no decimal point or exponent</p>
+			<p>19. random() is a random number from 0 up to 1, and rand(a, b) one from a up to b, eg. rand(1, 7)</p>
+			<p>20. |x| is the absolute value of x, eg. |3-7|, ||-3|-5|. A | where a number is expected opens a bar, so bitwise or inside bars needs parentheses, eg. |(1 | 2)|</p>
+			<p>21. A leading = is ignored, as in spreadsheets, eg. =1+2</p>
+			<p>22. Separate statements with ;, eg. x = 5; y = 3; x * y. They run in order and the result is the last one's</p>
+			<p>23. M+ and M- add the result to and subtract it from the memory, which MR recalls in expressions, eg. MR * 2. MC clears it</p>
+			<p>24. Spaces don't group digits, so 1 000 is an error: write 1000. Nor can they split an exponent, eg. 2e - 1, a name, eg. sin 1, or a hex literal, eg. 0xA B. Numbers separated only by spaces, eg. 2 3, are missing an operator, and **, //, &lt;&lt; and &gt;&gt; can't be split by spaces</p>
+			<p>25. Symbols pasted from documents are read as their ASCII equivalents: × and · as *, ÷ as / and − as -, eg. 6 × 7 − 2</p>
 		</div>
 		<form method="POST" class="ExpressionInput">
-			<input type="text" name="arithmetic_equation" maxlength="100" size="60" value="{{.ArithmeticEquation}}" required>
+			<input type="text" name="arithmetic_equation" maxlength="{{.MaxLength}}" size="60" value="{{.ArithmeticEquation}}" required>
+			<input type="number" name="precision" min="0" max="15" placeholder="decimals" value="{{.Precision}}">
+			<input type="number" name="sigfigs" min="1" max="15" placeholder="sig. figures" value="{{.SigFigs}}">
+			<select name="rounding">
+				<option value="round" {{if eq .Rounding "round"}}selected{{end}}>Round</option>
+				<option value="floor" {{if eq .Rounding "floor"}}selected{{end}}>Floor</option>
+				<option value="ceil" {{if eq .Rounding "ceil"}}selected{{end}}>Ceil</option>
+				<option value="trunc" {{if eq .Rounding "trunc"}}selected{{end}}>Truncate</option>
+			</select>
+			<label><input type="radio" name="angle" value="rad" {{if eq .Angle "rad"}}checked{{end}}>Radians</label>
+			<label><input type="radio" name="angle" value="deg" {{if eq .Angle "deg"}}checked{{end}}>Degrees</label>
+			<select name="locale">
+				<option value="en" {{if eq .Locale "en"}}selected{{end}}>en 1,234.5</option>
+				<option value="de" {{if eq .Locale "de"}}selected{{end}}>de 1.234,5</option>
+				<option value="es" {{if eq .Locale "es"}}selected{{end}}>es 1.234,5</option>
+				<option value="fr" {{if eq .Locale "fr"}}selected{{end}}>fr 1 234,5</option>
+				<option value="it" {{if eq .Locale "it"}}selected{{end}}>it 1.234,5</option>
+				<option value="nl" {{if eq .Locale "nl"}}selected{{end}}>nl 1.234,5</option>
+				<option value="pt" {{if eq .Locale "pt"}}selected{{end}}>pt 1.234,5</option>
+				<option value="ru" {{if eq .Locale "ru"}}selected{{end}}>ru 1 234,5</option>
+			</select>
+			<label><input type="checkbox" name="physics" {{if .Physics}}checked{{end}}>Physics constants</label>
+			<label><input type="checkbox" name="decimal" {{if .Decimal}}checked{{end}}>Exact decimal</label>
+			<label><input type="checkbox" name="exact" {{if .Exact}}checked{{end}}>Exact fraction</label>
+			<label><input type="checkbox" name="fractions" {{if .Fractions}}checked{{end}}>Integer fractions</label>
+			<input type="number" name="exact_digits" min="0" max="100" placeholder="digits" value="{{.ExactDigits}}">
+			<label><input type="checkbox" name="percent" {{if .Percent}}checked{{end}}>Percent</label>
+			<label><input type="checkbox" name="complex" {{if .Complex}}checked{{end}}>Complex</label>
+			<label><input type="checkbox" name="show_steps" {{if .ShowSteps}}checked{{end}}>Show steps</label>
+			<label><input type="checkbox" name="show_tree" {{if .ShowTree}}checked{{end}}>Show tree</label>
+			<label title="Name the subexpression an evaluation error is in"><input type="checkbox" name="partial" {{if .Partial}}checked{{end}}>Failing part</label>
+			<label><input type="checkbox" name="provenance" {{if .ShowProvenance}}checked{{end}}>Provenance</label>
 			<input type="submit" value="Calculate">
 		</form>
+		<form method="POST" action="/reset">
+			<input type="submit" value="Clear" title="Clear the input, history, ans, variables and memory">
+		</form>
+		<form method="POST" action="/memory">
+			<input type="submit" name="key" value="M+" title="Add the result to the memory">
+			<input type="submit" name="key" value="M-" title="Subtract the result from the memory">
+			<input type="submit" name="key" value="MR" title="Recall the memory">
+			<input type="submit" name="key" value="MC" title="Clear the memory">
+			{{if .Memory}}<span>Memory: {{.Memory}}</span>{{end}}
+		</form>
 		<p style="font-weight:bold; color:{{if.IsValid}}green {{else}}red{{end}};">
 			{{if.IsValid}}Valid Expression{{else}}Invalid Expression{{end}}
 		</p>
-		<h2>Result: {{.Result}}</h2>
+		<h2>Result: {{if .PreferScientific}}{{.ResultScientific}}{{else}}{{.Result}}{{end}}</h2>
+		{{if .ErrorMarker}}<pre>{{.ArithmeticEquation}}
+{{.ErrorMarker}}</pre>{{end}}
+		{{if .IsValid}}<p><a href="/?expr={{.ArithmeticEquation}}">Link to this calculation</a></p>{{end}}
+		{{if .ResultDecimal}}
+		<p>Decimal: {{.ResultDecimal}} &nbsp; {{if .Engineering}}Engineering{{else}}Scientific{{end}}: {{.ResultScientific}}{{if .ResultFraction}} &nbsp; Fraction: {{.ResultFraction}}{{end}}</p>
+		{{end}}
+		{{if .Steps}}
+		<h3>Steps</h3>
+		<ol>
+			{{range .Steps}}<li>{{.}}</li>{{end}}
+		</ol>
+		{{end}}
+		{{if .ShowTree}}<pre>{{.Tree}}</pre>{{end}}
+		{{if .ShowProvenance}}<pre>{{.Provenance}}</pre>{{end}}
+		{{if .History}}
+		<h3>History</h3>
+		<ol>
+			{{range .History}}
+			<li><a href="/?expr={{.Expression}}" title="Recalculate">{{.Expression}}</a> = {{if .Valid}}{{.Result}}{{else}}<span style="color:red;">{{if .Result}}{{.Result}}{{else}}Invalid Expression{{end}}</span>{{end}}</li>
+			{{end}}
+		</ol>
+		<form method="POST" action="/clear">
+			<input type="submit" value="Clear history">
+		</form>
+		{{end}}
 	</body>
 	</html>
-	`)
+	`))
 
-	if err != nil {
-		http.Error(w, "Failed to load template", http.StatusInternalServerError)
-		return
+// Calculator handler for the web form
+func (c *Calculator) calculatorHandler(w http.ResponseWriter, r *http.Request) {
+	// Set initial values for the page
+	pageVariables := PageVariables{
+		ArithmeticEquation: "",
+		IsValid:            false,
+		Result:             "",
+		Angle:              calc.Radians,
+		Locale:             r.FormValue("locale"),
+		MaxLength:          *maxLength,
 	}
-
-	// Render the template with the data
-	tmpl.Execute(w, pageVariables)
-}
-
-func performArithmeticCalculation(Expr string) (bool, string) {
-	if validateArithmeticExpression(Expr) {
-		tokens := tokenizeExpression(Expr)
-		tree := buildTree(tokens)
-		result := roundFloat(evaluate(tree), 4)
-
-		return true, strconv.FormatFloat(result, 'f', -1, 64)
-	} else {
-		return false, ""
+	scope := c.sessions.Scope(w, r)
+	if memory := scope.Memory(); memory != 0 {
+		pageVariables.Memory = calc.FormatFloat(memory, calc.DefaultPrecision, calc.RoundHalfAwayFromZero)
 	}
-}
 
-func validateArithmeticExpression(Expr string) bool {
-	Expr = strings.ReplaceAll(Expr, " ", "")
+	// Evaluate a submitted form, or a shared link such as /?expr=1%2B2*3
+	submitted := r.Method == http.MethodPost || r.URL.Query().Has("expr")
 
-	re := regexp.MustCompile(`^[0-9\+\-\*/\(\)\s.]+$`)
-
-	if !re.MatchString(Expr) {
-		return false
-	}
+	if submitted {
+		// Parse form data
+		r.ParseForm()
+		arithEq := r.FormValue("arithmetic_equation")
+		if r.Method != http.MethodPost {
+			arithEq = r.URL.Query().Get("expr")
+		}
 
-	_, err := parser.ParseExpr(Expr)
-	return err == nil
-}
+		// Trim once, so what is calculated, echoed back, linked and kept in
+		// the history is the same text
+		arithEq = strings.TrimSpace(arithEq)
+		opts := baseOptions()
+		opts.Physics = r.FormValue("physics") == "on"
+		opts.Decimal = r.FormValue("decimal") == "on"
+		opts.Exact = r.FormValue("exact") == "on"
+		opts.Fractions = r.FormValue("fractions") == "on"
+		opts.Percent = r.FormValue("percent") == "on"
+		opts.Complex = r.FormValue("complex") == "on"
+		opts.Steps = r.FormValue("show_steps") == "on"
+		opts.Partial = r.FormValue("partial") == "on"
+		opts.Vars = scope.Vars()
+
+		// Blank or invalid digits show the exact result as a fraction, too
+		// many are rejected by the calculation like any other setting
+		if digits, err := strconv.Atoi(r.FormValue("exact_digits")); err == nil && digits > 0 {
+			opts.ExactDigits = digits
+		}
 
-func tokenizeExpression(expression string) []string {
-	var tokens []string
-	var number strings.Builder
-	var prevToken string
-
-	for i, ch := range expression {
-		switch {
-		case unicode.IsDigit(ch) || ch == '.': // If digit, accumulate it
-			number.WriteRune(ch)
-		case ch == '+' || ch == '-' || ch == '*' || ch == '/': // If operator
-			if number.Len() > 0 {
-				tokens = append(tokens, number.String())
-				number.Reset()
+		// Perform the calculation
+		isValid, result := false, ""
+		var calculated calc.Result
+		locale, _ := parseLocale(r.FormValue("locale"))
+		sep, sepErr := parseSeparator(r.URL.Query().Get("sep"), locale)
+		if err := parseSettings(&opts, r.Form); err != nil {
+			result = "Error: " + err.Error()
+		} else if sepErr != nil {
+			result = "Error: " + sepErr.Error()
+		} else {
+			isValid, calculated = c.performArithmeticCalculation(r.Context(), arithEq, opts)
+			result = calculated.Text
+			if isValid {
+				if err := scope.Store(calculated); err != nil {
+					isValid, result = false, "Error: "+err.Error()
+				}
 			}
+		}
 
-			// Handle negative numbers (unary minus)
-			if ch == '-' {
-				if i == 0 || prevToken == "(" || prevToken == "" || prevToken == "+" || prevToken == "-" || prevToken == "*" || prevToken == "/" {
-					number.WriteRune(ch)
-					continue
-				}
+		// Update the pageVariables with input values and result
+		pageVariables.Result = result
+		pageVariables.IsValid = isValid
+		pageVariables.ArithmeticEquation = arithEq
+		pageVariables.Physics = opts.Physics
+		pageVariables.Decimal = opts.Decimal
+		pageVariables.Exact = opts.Exact
+		pageVariables.Fractions = opts.Fractions
+		pageVariables.Percent = opts.Percent
+		pageVariables.Complex = opts.Complex
+		pageVariables.ExactDigits = r.FormValue("exact_digits")
+		pageVariables.Precision = r.FormValue("precision")
+		pageVariables.SigFigs = r.FormValue("sigfigs")
+		pageVariables.Rounding = r.FormValue("rounding")
+		pageVariables.Angle = opts.Angle
+		pageVariables.ShowSteps = opts.Steps
+		pageVariables.Partial = opts.Partial
+		pageVariables.Steps = calculated.Steps
+		if isValid {
+			// Digits are grouped for display only, history keeps the raw text
+			pageVariables.Result = groupThousands(result, sep, locale.point())
+		}
+		if isValid && !opts.Complex && math.Abs(calculated.Value) > *displayLimit {
+			// A finite but huge result, eg. 9^99, means little as digits
+			pageVariables.Result = "result too large to display meaningfully"
+		} else if isValid && !opts.Complex {
+			// A complex result has no single value to show in other formats
+			decimal, scientific := resultFormats(calculated, opts)
+			if *notation == "engineering" {
+				scientific = engineering(scientific)
+				pageVariables.Engineering = true
 			}
+			pageVariables.ResultDecimal = groupThousands(decimal, sep, locale.point())
+			pageVariables.ResultScientific = strings.Replace(scientific, ".", locale.point(), 1)
+			pageVariables.ResultFraction = calculated.Fraction
+			pageVariables.PreferScientific = preferScientific(calculated.Value)
+		}
 
-			// Store operator separately
-			tokens = append(tokens, string(ch))
-			prevToken = string(ch)
+		// Point at the character an error is at. Overlong expressions
+		// are rejected before parsing, so there is nothing to point at.
+		if !isValid && checkLength(arithEq) == nil {
+			if pos := calc.ErrorPosition(calc.Check(arithEq, opts)); pos > 0 {
+				pageVariables.ErrorMarker = strings.Repeat(" ", pos-1) + "^"
+			}
+		}
 
-		// If parenthesis
-		case ch == '(' || ch == ')':
-			if number.Len() > 0 {
-				tokens = append(tokens, number.String())
-				number.Reset()
+		c.history.Add(HistoryEntry{Expression: arithEq, Result: result, Valid: isValid})
+
+		// Show how the expression was parsed if requested
+		if r.FormValue("show_tree") == "on" {
+			pageVariables.ShowTree = true
+			if err := checkLength(arithEq); err != nil {
+				pageVariables.Tree = err.Error()
+			} else if _, tree, err := parseTree(arithEq, opts); err != nil {
+				pageVariables.Tree = err.Error()
+			} else {
+				pageVariables.Tree = formatTree(tree)
 			}
+		}
 
-			// Check for implicit multiplication: number followed by '('
-			if ch == '(' && len(tokens) > 0 {
-				lastToken := tokens[len(tokens)-1]
-				if unicode.IsDigit(rune(lastToken[len(lastToken)-1])) || lastToken == ")" {
-					tokens = append(tokens, "*")
-				}
+		// Attach the audit record if requested
+		if r.FormValue("provenance") == "on" {
+			record, _ := json.MarshalIndent(newProvenance(arithEq, opts, isValid, result), "", "  ")
+			pageVariables.ShowProvenance = true
+			pageVariables.Provenance = string(record)
+		}
+
+		// Remember the expression for the next visit
+		if *autosave {
+			http.SetCookie(w, &http.Cookie{
+				Name:     lastExpressionCookie,
+				Value:    url.QueryEscape(arithEq),
+				Path:     "/",
+				MaxAge:   30 * 24 * 60 * 60,
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	} else if *autosave {
+		// Repopulate the input with the remembered expression
+		if cookie, err := r.Cookie(lastExpressionCookie); err == nil {
+			if arithEq, err := url.QueryUnescape(cookie.Value); err == nil {
+				pageVariables.ArithmeticEquation = arithEq
 			}
+		}
+	}
+
+	pageVariables.History = c.history.Entries()
 
-			tokens = append(tokens, string(ch)) // Store parentheses separately
-			prevToken = string(ch)
-		case ch == ' ': // Ignore spaces
-			continue
-		default:
-			fmt.Println("Unexpected character:", string(ch))
+	// Flag invalid submissions in the status code if requested
+	if *invalidStatus && submitted && !pageVariables.IsValid {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+
+	// Render the template with the data
+	calculatorTemplate.Execute(w, pageVariables)
+}
+
+// baseOptions returns the calculation options configured by flags
+func baseOptions() calc.Options {
+	opts := calc.DefaultOptions()
+	opts.Scale = *decimalScale
+	opts.MaxDepth = *maxDepth
+	opts.LenientSeparators = *lenientSeps
+	opts.Aliases = aliases
+	return opts
+}
+
+// aliases are the operator aliases parsed from -aliases
+var aliases map[rune]rune
+
+// parseAliases parses comma separated pairs of an alias and its operator,
+// such as ":/,@*", where blank means none
+func parseAliases(list string) (map[rune]rune, error) {
+	if list == "" {
+		return nil, nil
+	}
+
+	parsed := make(map[rune]rune)
+	for _, pair := range strings.Split(list, ",") {
+		chars := []rune(strings.TrimSpace(pair))
+		if len(chars) != 2 {
+			return nil, fmt.Errorf("%q is not an alias followed by its operator, eg. :/", pair)
+		}
+		if _, exists := parsed[chars[0]]; exists {
+			return nil, fmt.Errorf("alias %q is given twice", chars[0])
 		}
+		parsed[chars[0]] = chars[1]
 	}
 
-	// Add last accumulated number
-	if number.Len() > 0 {
-		tokens = append(tokens, number.String())
+	if err := calc.CheckAliases(parsed); err != nil {
+		return nil, err
 	}
+	return parsed, nil
+}
 
-	return tokens
+// parsePrecision parses a requested number of decimal places, where blank
+// means the default
+func parsePrecision(value string) (int, error) {
+	if value == "" {
+		return calc.DefaultPrecision, nil
+	}
+
+	precision, err := strconv.Atoi(value)
+	if err != nil || precision < 0 || precision > calc.MaxPrecision {
+		return 0, fmt.Errorf("precision must be a whole number between 0 and %d", calc.MaxPrecision)
+	}
+	return precision, nil
 }
 
-func buildTree(tokens []string) *Node {
-	if len(tokens) == 0 {
-		return nil
+// parseSigFigs parses a requested number of significant figures, where blank
+// means rounding to decimal places instead
+func parseSigFigs(value string) (int, error) {
+	if value == "" {
+		return 0, nil
 	}
 
-	precedence := map[string]int{
-		"+": 1, "-": 1,
-		"*": 2, "/": 2,
+	digits, err := strconv.Atoi(value)
+	if err != nil || digits < 1 || digits > calc.MaxSigFigs {
+		return 0, fmt.Errorf("significant figures must be a whole number between 1 and %d", calc.MaxSigFigs)
 	}
+	return digits, nil
+}
 
-	var build func(int, int) *Node
-	build = func(start, end int) *Node {
-		if start > end {
-			return nil
-		}
+// parseSettings applies the requested precision, significant figures,
+// rounding mode, angle unit and locale to opts
+func parseSettings(opts *calc.Options, values url.Values) error {
+	locale, err := parseLocale(values.Get("locale"))
+	if err != nil {
+		return err
+	}
+	opts.DecimalComma = locale.decimalComma
 
-		// If single number, return as node
-		if start == end {
-			if _, err := strconv.ParseFloat(tokens[start], 64); err == nil {
-				return &Node{Value: tokens[start]}
-			}
-		}
+	if opts.Precision, err = parsePrecision(values.Get("precision")); err != nil {
+		return err
+	}
+	if opts.SigFigs, err = parseSigFigs(values.Get("sigfigs")); err != nil {
+		return err
+	}
+	if opts.Rounding, err = calc.ParseRoundingMode(values.Get("rounding")); err != nil {
+		return err
+	}
+	opts.Angle, err = calc.ParseAngleMode(values.Get("angle"))
+	return err
+}
 
-		// Handle unary minus (e.g., "-2")
-		if tokens[start] == "-" && start+1 <= end {
-			if _, err := strconv.ParseFloat(tokens[start+1], 64); err == nil {
-				return &Node{
-					Value: tokens[start] + tokens[start+1], // "-2"
-				}
-			}
-		}
+// performArithmeticCalculation returns whether the expression is valid and
+// its result. The text of an invalid result is the error to show, if any.
+// Outcomes are cached, except timeouts which depend on the server's load and
+// expressions calling random or rand, which differ every time.
+func (c *Calculator) performArithmeticCalculation(ctx context.Context, Expr string, opts calc.Options) (bool, calc.Result) {
+	// Overlong expressions are rejected by safeCalculate without filling
+	// the cache with their keys
+	if !calc.IsDeterministic(Expr) || checkLength(Expr) != nil {
+		valid, result, _ := c.evaluate(ctx, Expr, opts)
+		return valid, result
+	}
 
-		// Handle surrounding parentheses
-		if tokens[start] == "(" && tokens[end] == ")" {
-			return build(start+1, end-1)
-		}
+	key := cacheKey(Expr, opts)
+	if valid, result, cached := c.cache.Get(key); cached {
+		c.metrics.Record(len(Expr), valid)
+		return valid, result
+	}
 
-		// Find the lowest precedence operator (outside of parentheses)
-		minPrecedence := 3
-		opIndex := -1
-		parens := 0
-
-		for i := start; i <= end; i++ {
-			switch tokens[i] {
-			case "(":
-				parens++
-			case ")":
-				parens--
-			default:
-				if parens == 0 {
-					if prec, exists := precedence[tokens[i]]; exists {
-						if prec <= minPrecedence {
-							minPrecedence = prec
-							opIndex = i
-						}
-					}
-				}
-			}
-		}
+	valid, result, cacheable := c.evaluate(ctx, Expr, opts)
+	if cacheable {
+		c.cache.Put(key, valid, result)
+	}
+	return valid, result
+}
 
-		// If an operator was found, split at that point
-		if opIndex != -1 {
-			return &Node{
-				Value: tokens[opIndex],
-				Left:  build(start, opIndex-1),
-				Right: build(opIndex+1, end),
-			}
-		}
+// evaluate is performArithmeticCalculation without the cache, also
+// reporting whether the outcome may be cached
+func (c *Calculator) evaluate(ctx context.Context, Expr string, opts calc.Options) (bool, calc.Result, bool) {
+	result, err := c.safeCalculate(ctx, Expr, opts)
+
+	switch {
+	case errors.Is(err, calc.ErrTimeout):
+		return false, calc.Result{Text: "Error: " + err.Error()}, false
+	case err == calc.ErrInvalidExpression:
+		// With no position there is no more to say than the page does
+		return false, calc.Result{}, true
+	case err != nil:
+		return false, calc.Result{Text: "Error: " + err.Error()}, true
+	}
+	return true, result, true
+}
 
-		return nil
+// resultFormats returns the result as a plain decimal and in scientific
+// notation, to the selected precision or significant figures
+func resultFormats(result calc.Result, opts calc.Options) (string, string) {
+	decimal := result.Text
+	if opts.Exact && opts.ExactDigits == 0 || opts.Fractions && result.Fraction != "" {
+		decimal = calc.FormatFloat(result.Value, opts.Precision, opts.Rounding)
+	}
+	if opts.SigFigs > 0 {
+		return decimal, strconv.FormatFloat(calc.RoundSigFigs(result.Value, opts.SigFigs, opts.Rounding), 'e', opts.SigFigs-1, 64)
 	}
+	return decimal, strconv.FormatFloat(result.Value, 'e', opts.Precision, 64)
+}
 
-	return build(0, len(tokens)-1)
+// preferScientific reports whether a value is too large or too small to read
+// comfortably as a plain decimal, being outside -sci-below to -sci-above
+func preferScientific(val float64) bool {
+	magnitude := math.Abs(val)
+	return magnitude >= *sciAbove || (magnitude != 0 && magnitude < *sciBelow)
 }
 
-func evaluate(node *Node) float64 {
-	if node == nil {
-		return 0
+// engineering rewrites a number in scientific notation, as formatted by
+// strconv, so its exponent is a multiple of 3, eg. 1.2345e+04 is
+// 12.345e+03. The significant digits are unchanged.
+func engineering(scientific string) string {
+	mantissa, exp, found := strings.Cut(scientific, "e")
+	exponent, err := strconv.Atoi(exp)
+	if !found || err != nil {
+		return scientific
 	}
 
-	// If it's a number, return it
-	if node.Left == nil && node.Right == nil {
-		num, err := strconv.ParseFloat(node.Value, 64)
-		if err != nil {
-			panic("Invalid number: " + node.Value)
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") {
+		sign, mantissa = "-", mantissa[1:]
+	}
+	digits := strings.Replace(mantissa, ".", "", 1)
+
+	// Move the point right until the exponent is a multiple of 3
+	shift := (exponent%3 + 3) % 3
+	if len(digits) < shift+1 {
+		digits += strings.Repeat("0", shift+1-len(digits))
+	}
+	whole, fraction := digits[:shift+1], digits[shift+1:]
+	if fraction != "" {
+		whole += "." + fraction
+	}
+	return fmt.Sprintf("%s%se%+03d", sign, whole, exponent-shift)
+}
+
+// safeCalculate runs calc.CalculateContext under the -timeout deadline,
+// turning any panic into an error so a bad expression can't break the
+// request. Every calculation is counted in the metrics.
+func (c *Calculator) safeCalculate(ctx context.Context, Expr string, opts calc.Options) (result calc.Result, err error) {
+	ctx, cancel := context.WithTimeout(ctx, *evalTimeout)
+	defer cancel()
+
+	// Deferred first so it sees the error set by the recovery below
+	defer func() {
+		c.metrics.Record(len(Expr), err == nil)
+		logCalculation(ctx, Expr, result, err)
+	}()
+
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("panic while calculating", "expression", truncateForLog(Expr), "panic", r, "request_id", requestID(ctx))
+			result, err = calc.Result{}, errors.New("could not evaluate expression")
 		}
-		return num
+	}()
+
+	if err := checkLength(Expr); err != nil {
+		return calc.Result{}, err
 	}
+	return calc.CalculateContext(ctx, Expr, opts)
+}
 
-	// Handle unary minus case
-	if node.Left == nil && node.Value == "-" {
-		return -evaluate(node.Right)
+// checkLength rejects expressions longer than -max-length characters
+func checkLength(Expr string) error {
+	if utf8.RuneCountInString(Expr) > *maxLength {
+		return fmt.Errorf("expression too long, the limit is %d characters", *maxLength)
 	}
+	return nil
+}
 
-	// Evaluate left and right subtrees
-	leftVal := evaluate(node.Left)
-	rightVal := evaluate(node.Right)
+// maxLoggedExpression caps how much of an expression is logged, since the
+// JSON API accepts expressions of any length
+const maxLoggedExpression = 200
 
-	// Perform the operation
-	switch node.Value {
-	case "+":
-		return leftVal + rightVal
-	case "-":
-		return leftVal - rightVal
-	case "*":
-		return leftVal * rightVal
-	case "/":
-		if rightVal == 0 {
-			panic("division by zero")
-		}
-		return leftVal / rightVal
-	default:
-		panic("unknown operator: " + node.Value)
+// truncateForLog shortens an expression to maxLoggedExpression bytes
+func truncateForLog(Expr string) string {
+	if len(Expr) <= maxLoggedExpression {
+		return Expr
 	}
+	return strings.ToValidUTF8(Expr[:maxLoggedExpression], "") + "..."
 }
 
-func roundFloat(val float64, precision uint) float64 {
-	ratio := math.Pow(10, float64(precision))
-	return math.Round(val*ratio) / ratio
+// logCalculation logs a calculation and its outcome unless -quiet is set,
+// with the ID of the API request it was made for, if any
+func logCalculation(ctx context.Context, Expr string, result calc.Result, err error) {
+	if *quiet {
+		return
+	}
+
+	attrs := []any{"expression", truncateForLog(Expr), "length", len(Expr), "valid", err == nil}
+	if id := requestID(ctx); id != "" {
+		attrs = append(attrs, "request_id", id)
+	}
+	if err != nil {
+		attrs = append(attrs, "error", err.Error())
+	} else {
+		attrs = append(attrs, "result", result.Text)
+	}
+	slog.Info("calculation", attrs...)
 }
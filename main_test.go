@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+func TestMain(m *testing.M) {
+	*quiet = true
+	os.Exit(m.Run())
+}
+
+// newTestCalculator returns a calculator with an in-memory history
+func newTestCalculator() *Calculator {
+	return NewCalculator(NewHistory(historySize), 0)
+}
+
+// postJSON sends body as JSON to the handler and returns the recorded
+// response
+func postJSON(t *testing.T, h http.HandlerFunc, target string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(data))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// decodeResponse decodes the recorded JSON response into v
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, v any) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("invalid JSON response %q: %v", w.Body, err)
+	}
+}
+
+// postForm submits the calculator form with the given values and returns
+// the recorded response
+func postForm(c *Calculator, values url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	c.calculatorHandler(w, r)
+	return w
+}
+
+// setFlag sets a flag for the rest of the test
+func setFlag[T any](t *testing.T, flag *T, value T) {
+	t.Helper()
+	old := *flag
+	*flag = value
+	t.Cleanup(func() { *flag = old })
+}
+
+func TestAutosave(t *testing.T) {
+	c := newTestCalculator()
+	w := postForm(c, url.Values{"arithmetic_equation": {"12 * (3 + 4)"}})
+
+	var saved *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == lastExpressionCookie {
+			saved = cookie
+		}
+	}
+	if saved == nil {
+		t.Fatal("submitting the form set no last expression cookie")
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(saved)
+	w = httptest.NewRecorder()
+	c.calculatorHandler(w, r)
+	if want := `value="12 * (3 &#43; 4)"`; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("page after the cookie has no %s", want)
+	}
+}
+
+func TestExactDigitsLimit(t *testing.T) {
+	c := newTestCalculator()
+	w := postForm(c, url.Values{"arithmetic_equation": {"1 / 3"}, "exact": {"on"}, "exact_digits": {"1000000"}})
+	if want := "Error: exact digits must be between 0 and 100"; !strings.Contains(w.Body.String(), want) {
+		t.Errorf("1000000 exact digits: page has no %q", want)
+	}
+}
+
+func TestAutosaveDisabled(t *testing.T) {
+	setFlag(t, autosave, false)
+	c := newTestCalculator()
+	w := postForm(c, url.Values{"arithmetic_equation": {"1 + 2"}})
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == lastExpressionCookie {
+			t.Errorf("submitting the form set cookie %v with autosave off", cookie)
+		}
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: lastExpressionCookie, Value: url.QueryEscape("5 * 5")})
+	w = httptest.NewRecorder()
+	c.calculatorHandler(w, r)
+	if strings.Contains(w.Body.String(), "5 * 5") {
+		t.Error("page repopulated the cookie's expression with autosave off")
+	}
+}
+
+func TestInvalidStatus(t *testing.T) {
+	tests := []struct {
+		invalid422 bool
+		expr       string
+		status     int
+	}{
+		{invalid422: false, expr: "1 +", status: http.StatusOK},
+		{invalid422: false, expr: "1 + 2", status: http.StatusOK},
+		{invalid422: true, expr: "1 +", status: http.StatusUnprocessableEntity},
+		{invalid422: true, expr: "1 / 0", status: http.StatusUnprocessableEntity},
+		{invalid422: true, expr: "1 + 2", status: http.StatusOK},
+	}
+
+	c := newTestCalculator()
+	for _, tc := range tests {
+		setFlag(t, invalidStatus, tc.invalid422)
+		w := postForm(c, url.Values{"arithmetic_equation": {tc.expr}})
+		if w.Code != tc.status {
+			t.Errorf("%s with -invalid-422=%v: status %d, want %d", tc.expr, tc.invalid422, w.Code, tc.status)
+		}
+		if !strings.Contains(w.Body.String(), "<html") {
+			t.Errorf("%s with -invalid-422=%v: the page wasn't rendered", tc.expr, tc.invalid422)
+		}
+	}
+
+	// Opening the page isn't a submission, so it is never invalid
+	w := httptest.NewRecorder()
+	c.calculatorHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("opening the page with -invalid-422: status %d", w.Code)
+	}
+}
+
+func TestResultFormatsSigFigs(t *testing.T) {
+	tests := []struct {
+		expr       string
+		sigFigs    int
+		decimal    string
+		scientific string
+	}{
+		{expr: "123456", sigFigs: 3, decimal: "123000", scientific: "1.23e+05"},
+		{expr: "0.00012345", sigFigs: 3, decimal: "0.000123", scientific: "1.23e-04"},
+		{expr: "1.5", sigFigs: 3, decimal: "1.50", scientific: "1.50e+00"},
+		{expr: "123456", sigFigs: 0, decimal: "123456", scientific: "1.2346e+05"},
+	}
+	for _, tc := range tests {
+		opts := calc.DefaultOptions()
+		opts.SigFigs = tc.sigFigs
+		result, err := calc.CalculateResult(tc.expr, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decimal, scientific := resultFormats(result, opts)
+		if decimal != tc.decimal || scientific != tc.scientific {
+			t.Errorf("%s to %d figures: %s and %s, want %s and %s", tc.expr, tc.sigFigs, decimal, scientific, tc.decimal, tc.scientific)
+		}
+	}
+}
+
+func TestPreferScientific(t *testing.T) {
+	setFlag(t, sciAbove, 1e9)
+	setFlag(t, sciBelow, 1e-6)
+	tests := []struct {
+		val  float64
+		want bool
+	}{
+		{val: 0, want: false},
+		{val: 1, want: false},
+		{val: 999999999, want: false},
+		{val: 1e9, want: true},
+		{val: -1e9, want: true},
+		{val: 1e-6, want: false},
+		{val: 9.99e-7, want: true},
+		{val: -9.99e-7, want: true},
+	}
+	for _, tc := range tests {
+		if got := preferScientific(tc.val); got != tc.want {
+			t.Errorf("%v: scientific %v, want %v", tc.val, got, tc.want)
+		}
+	}
+}
+
+func TestEngineering(t *testing.T) {
+	tests := []struct {
+		scientific string
+		want       string
+	}{
+		{scientific: "1.2345e+04", want: "12.345e+03"},
+		{scientific: "1.2345e+05", want: "123.45e+03"},
+		{scientific: "1.2345e+06", want: "1.2345e+06"},
+		{scientific: "-1.5e-07", want: "-150e-09"},
+		{scientific: "1e+00", want: "1e+00"},
+		{scientific: "12", want: "12"},
+	}
+	for _, tc := range tests {
+		if got := engineering(tc.scientific); got != tc.want {
+			t.Errorf("%s: %s, want %s", tc.scientific, got, tc.want)
+		}
+	}
+}
+
+func TestNotationThreshold(t *testing.T) {
+	setFlag(t, sciAbove, 1e9)
+	setFlag(t, sciBelow, 1e-6)
+	tests := []struct {
+		expr     string
+		notation string
+		want     string
+	}{
+		{expr: "999999999", notation: "scientific", want: "Result: 999,999,999<"},
+		{expr: "10^9", notation: "scientific", want: "Result: 1.0000e&#43;09<"},
+		{expr: "12345 * 10^6", notation: "engineering", want: "Result: 12.345e&#43;09<"},
+	}
+	c := newTestCalculator()
+	for _, tc := range tests {
+		setFlag(t, notation, tc.notation)
+		w := postForm(c, url.Values{"arithmetic_equation": {tc.expr}})
+		if !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s in %s notation: page has no %q", tc.expr, tc.notation, tc.want)
+		}
+	}
+
+	// The API returns the value as is, whatever its magnitude
+	w := postJSON(t, c.apiCalculateHandler, "/api/calculate", CalculateRequest{Expression: "10^9"})
+	var resp CalculateResponse
+	decodeResponse(t, w, &resp)
+	if resp.Result != "1000000000" {
+		t.Errorf("API result %q for 10^9", resp.Result)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// lengthBuckets are the upper bounds of the expression length histogram
+var lengthBuckets = []int{10, 25, 50, 100, 250, 1000}
+
+// Metrics counts calculations for the /metrics endpoint, safe for concurrent
+// use by request handlers
+type Metrics struct {
+	mu      sync.Mutex
+	valid   int
+	invalid int
+	// lengths counts expressions per bucket, with a final bucket for
+	// anything longer than the last bound
+	lengths   []int
+	lengthSum int
+}
+
+// NewMetrics returns metrics with nothing counted
+func NewMetrics() *Metrics {
+	return &Metrics{lengths: make([]int, len(lengthBuckets)+1)}
+}
+
+// Record counts a calculation of an expression with the given length
+func (m *Metrics) Record(length int, valid bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if valid {
+		m.valid++
+	} else {
+		m.invalid++
+	}
+
+	bucket := len(lengthBuckets)
+	for i, bound := range lengthBuckets {
+		if length <= bound {
+			bucket = i
+			break
+		}
+	}
+	m.lengths[bucket]++
+	m.lengthSum += length
+}
+
+// Expose writes the metrics in the Prometheus text exposition format
+func (m *Metrics) Expose(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP gocalculate_calculations_total Calculations performed, by whether the expression was valid.")
+	fmt.Fprintln(w, "# TYPE gocalculate_calculations_total counter")
+	fmt.Fprintf(w, "gocalculate_calculations_total{result=\"valid\"} %d\n", m.valid)
+	fmt.Fprintf(w, "gocalculate_calculations_total{result=\"invalid\"} %d\n", m.invalid)
+
+	fmt.Fprintln(w, "# HELP gocalculate_expression_length Length of calculated expressions in bytes.")
+	fmt.Fprintln(w, "# TYPE gocalculate_expression_length histogram")
+	cumulative := 0
+	for i, bound := range lengthBuckets {
+		cumulative += m.lengths[i]
+		fmt.Fprintf(w, "gocalculate_expression_length_bucket{le=\"%d\"} %d\n", bound, cumulative)
+	}
+	cumulative += m.lengths[len(lengthBuckets)]
+	fmt.Fprintf(w, "gocalculate_expression_length_bucket{le=\"+Inf\"} %d\n", cumulative)
+	fmt.Fprintf(w, "gocalculate_expression_length_sum %d\n", m.lengthSum)
+	fmt.Fprintf(w, "gocalculate_expression_length_count %d\n", cumulative)
+}
+
+// metricsHandler serves the metrics for scraping
+func (c *Calculator) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.metrics.Expose(w)
+}
+
+// healthHandler reports that the server is up, for liveness checks
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
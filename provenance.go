@@ -0,0 +1,124 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// ProvenanceSettings are the evaluation settings a result depends on
+type ProvenanceSettings struct {
+	Mode              string `json:"mode"`
+	Precision         int    `json:"precision"`
+	SigFigs           int    `json:"sig_figs,omitempty"`
+	Rounding          string `json:"rounding"`
+	Angle             string `json:"angle"`
+	Physics           bool   `json:"physics"`
+	LenientSeparators bool   `json:"lenient_separators"`
+	DecimalComma      bool   `json:"decimal_comma"`
+	Percent           bool   `json:"percent"`
+}
+
+// Provenance records how a result was computed, for audit logs
+type Provenance struct {
+	Input      string             `json:"input"`
+	Settings   ProvenanceSettings `json:"settings"`
+	Valid      bool               `json:"valid"`
+	Result     string             `json:"result"`
+	GoVersion  string             `json:"go_version"`
+	Version    string             `json:"version"`
+	Modules    map[string]string  `json:"modules,omitempty"`
+	ResultHash string             `json:"result_hash"`
+}
+
+// newProvenance builds the provenance record for a calculation. The hash
+// covers the normalized input, the settings and the result, so it is stable
+// for identical inputs and settings.
+func newProvenance(expr string, opts calc.Options, valid bool, result string) Provenance {
+	normalized, err := calc.Preprocess(expr, calc.PreprocessorsFor(opts))
+	if err != nil {
+		normalized = expr
+	}
+
+	settings := ProvenanceSettings{
+		Mode:              "float64",
+		Precision:         opts.Precision,
+		SigFigs:           opts.SigFigs,
+		Rounding:          roundingDescription(opts.Rounding),
+		Angle:             string(opts.Angle),
+		Physics:           opts.Physics,
+		LenientSeparators: opts.LenientSeparators,
+		DecimalComma:      opts.DecimalComma,
+		Percent:           opts.Percent,
+	}
+	if opts.Decimal {
+		settings.Mode = "decimal"
+		settings.Precision = opts.Scale
+		settings.SigFigs = 0
+		settings.Rounding = "half away from zero"
+	}
+	if opts.Exact {
+		settings.Mode = "exact"
+		settings.Precision = opts.ExactDigits
+		settings.SigFigs = 0
+		settings.Rounding = "none"
+		if opts.ExactDigits > 0 {
+			settings.Rounding = "half away from zero"
+		}
+	}
+	if opts.Complex {
+		settings.Mode = "complex"
+		settings.Precision = opts.Precision
+		settings.SigFigs = 0
+		settings.Rounding = roundingDescription(opts.Rounding)
+	}
+
+	p := Provenance{
+		Input:     normalized,
+		Settings:  settings,
+		Valid:     valid,
+		Result:    result,
+		GoVersion: runtime.Version(),
+		Version:   "(devel)",
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		p.Version = info.Main.Version
+		for _, dep := range info.Deps {
+			if p.Modules == nil {
+				p.Modules = make(map[string]string)
+			}
+			p.Modules[dep.Path] = dep.Version
+		}
+	}
+
+	// Hash only the fields that determine the result
+	hashed, _ := json.Marshal(struct {
+		Input    string             `json:"input"`
+		Settings ProvenanceSettings `json:"settings"`
+		Valid    bool               `json:"valid"`
+		Result   string             `json:"result"`
+	}{p.Input, p.Settings, p.Valid, p.Result})
+	sum := sha256.Sum256(hashed)
+	p.ResultHash = hex.EncodeToString(sum[:])
+
+	return p
+}
+
+// roundingDescription describes how a float64 result was rounded
+func roundingDescription(mode calc.RoundingMode) string {
+	switch mode {
+	case calc.RoundFloor:
+		return "toward negative infinity"
+	case calc.RoundCeil:
+		return "toward positive infinity"
+	case calc.RoundTrunc:
+		return "toward zero"
+	default:
+		return "half away from zero"
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"net/url"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+func TestProvenance(t *testing.T) {
+	exact := calc.DefaultOptions()
+	exact.Exact = true
+	decimal := calc.DefaultOptions()
+	decimal.Decimal = true
+	decimal.Scale = 10
+	floor := calc.DefaultOptions()
+	floor.Rounding = calc.RoundFloor
+	floor.Angle = calc.Degrees
+
+	tests := []struct {
+		expr     string
+		opts     calc.Options
+		input    string
+		settings ProvenanceSettings
+	}{
+		{expr: " 1 + 2 ", opts: calc.DefaultOptions(), input: "1+2", settings: ProvenanceSettings{Mode: "float64", Precision: 4, Rounding: "half away from zero", Angle: "rad"}},
+		{expr: "1/3", opts: exact, input: "1/3", settings: ProvenanceSettings{Mode: "exact", Rounding: "none", Angle: "rad"}},
+		{expr: "1/3", opts: decimal, input: "1/3", settings: ProvenanceSettings{Mode: "decimal", Precision: 10, Rounding: "half away from zero", Angle: "rad"}},
+		{expr: "sin(30)", opts: floor, input: "sin(30)", settings: ProvenanceSettings{Mode: "float64", Precision: 4, Rounding: "toward negative infinity", Angle: "deg"}},
+	}
+	for _, tc := range tests {
+		p := newProvenance(tc.expr, tc.opts, true, "3")
+		if p.Input != tc.input {
+			t.Errorf("%s: input %q, want %q", tc.expr, p.Input, tc.input)
+		}
+		if p.Settings != tc.settings {
+			t.Errorf("%s: settings %+v, want %+v", tc.expr, p.Settings, tc.settings)
+		}
+		if !p.Valid || p.Result != "3" {
+			t.Errorf("%s: valid %v result %q, want true 3", tc.expr, p.Valid, p.Result)
+		}
+		if p.GoVersion != runtime.Version() || p.Version == "" {
+			t.Errorf("%s: Go version %q, version %q", tc.expr, p.GoVersion, p.Version)
+		}
+		if len(p.ResultHash) != 64 {
+			t.Errorf("%s: result hash %q isn't a hex SHA-256", tc.expr, p.ResultHash)
+		}
+	}
+}
+
+func TestProvenanceHash(t *testing.T) {
+	opts := calc.DefaultOptions()
+	hash := newProvenance("1 + 2", opts, true, "3").ResultHash
+
+	// Spacing is normalized away, so it doesn't change the hash
+	if again := newProvenance("1+2", opts, true, "3").ResultHash; again != hash {
+		t.Errorf("hash %s for 1+2, %s for 1 + 2", again, hash)
+	}
+
+	precise := opts
+	precise.Precision = 6
+	changed := []struct {
+		name string
+		p    Provenance
+	}{
+		{name: "input", p: newProvenance("2 + 1", opts, true, "3")},
+		{name: "settings", p: newProvenance("1 + 2", precise, true, "3")},
+		{name: "result", p: newProvenance("1 + 2", opts, true, "4")},
+		{name: "validity", p: newProvenance("1 + 2", opts, false, "3")},
+	}
+	for _, tc := range changed {
+		if tc.p.ResultHash == hash {
+			t.Errorf("changing the %s left the hash %s", tc.name, hash)
+		}
+	}
+}
+
+func TestProvenancePage(t *testing.T) {
+	c := newTestCalculator()
+	w := postForm(c, url.Values{"arithmetic_equation": {"1 + 2"}, "provenance": {"on"}})
+	for _, field := range []string{"&#34;input&#34;: &#34;1&#43;2&#34;", "&#34;result_hash&#34;"} {
+		if !strings.Contains(w.Body.String(), field) {
+			t.Errorf("page has no provenance field %s", field)
+		}
+	}
+
+	w = postForm(c, url.Values{"arithmetic_equation": {"1 + 2"}})
+	if strings.Contains(w.Body.String(), "result_hash") {
+		t.Error("page has a provenance record that wasn't requested")
+	}
+}
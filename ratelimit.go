@@ -0,0 +1,154 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBuckets bounds the number of clients tracked, beyond which the least
+// recently seen are forgotten
+const maxBuckets = 10000
+
+// bucket is a token bucket for one client
+type bucket struct {
+	client string
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter limits each client IP to rate requests per second with bursts
+// of up to burst requests, safe for concurrent use
+type RateLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*list.Element
+	// order holds the buckets from the least to the most recently used
+	order   *list.List
+	trusted []netip.Prefix
+	now     func() time.Time
+}
+
+// NewRateLimiter returns a limiter allowing rate requests per second per
+// client with the given burst. X-Forwarded-For is only believed for requests
+// arriving from one of the trusted proxies.
+func NewRateLimiter(rate float64, burst int, trusted []netip.Prefix) *RateLimiter {
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+		trusted: trusted,
+		now:     time.Now,
+	}
+}
+
+// ParseTrustedProxies parses a comma separated list of proxy IPs and CIDR
+// ranges
+func ParseTrustedProxies(list string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if prefix, err := netip.ParsePrefix(entry); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Allow reports whether the client may make another request now
+func (l *RateLimiter) Allow(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	elem, exists := l.buckets[client]
+	if exists {
+		l.order.MoveToBack(elem)
+	} else {
+		// Forgetting a client gives it a full bucket again, so forget the
+		// one seen longest ago, the most likely to have refilled anyway
+		if l.order.Len() >= maxBuckets {
+			oldest := l.order.Front()
+			l.order.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*bucket).client)
+		}
+		elem = l.order.PushBack(&bucket{client: client, tokens: l.burst, last: now})
+		l.buckets[client] = elem
+	}
+	b := elem.Value.(*bucket)
+
+	// Refill for the time since the last request
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Wrap rejects requests over the limit with 429 Too Many Requests
+func (l *RateLimiter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.Allow(l.clientIP(r)) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP returns the address the request came from. Behind a trusted
+// proxy this is the last X-Forwarded-For hop not added by a trusted proxy.
+func (l *RateLimiter) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !l.isTrusted(remote) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		if !l.isTrusted(hop) {
+			return hop.String()
+		}
+	}
+	return host
+}
+
+// isTrusted reports whether the address belongs to a trusted proxy
+func (l *RateLimiter) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range l.trusted {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWrap(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(1, 2, nil)
+	l.now = func() time.Time { return now }
+	h := l.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := func(remote string) int {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = remote
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// The burst is allowed, then the client must wait for a token
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := get("192.0.2.1:1234"); got != want {
+			t.Errorf("request %d: status %d, want %d", i+1, got, want)
+		}
+	}
+	if got := get("192.0.2.2:1234"); got != http.StatusOK {
+		t.Errorf("another client: status %d, want %d", got, http.StatusOK)
+	}
+
+	now = now.Add(time.Second)
+	if got := get("192.0.2.1:1234"); got != http.StatusOK {
+		t.Errorf("after a second: status %d, want %d", got, http.StatusOK)
+	}
+	if got := get("192.0.2.1:1234"); got != http.StatusTooManyRequests {
+		t.Errorf("second request after a second: status %d, want %d", got, http.StatusTooManyRequests)
+	}
+}
+
+func TestRateLimiterMaxBuckets(t *testing.T) {
+	now := time.Now()
+	l := NewRateLimiter(1, 1, nil)
+	l.now = func() time.Time { return now }
+
+	// No bucket refills, so only eviction keeps the map bounded
+	for i := 0; i < maxBuckets+10; i++ {
+		l.Allow(fmt.Sprint("client", i))
+		if i == 0 {
+			l.Allow("client0")
+		}
+	}
+	if len(l.buckets) != maxBuckets || l.order.Len() != maxBuckets {
+		t.Fatalf("%d buckets kept, want %d", len(l.buckets), maxBuckets)
+	}
+	if _, exists := l.buckets["client0"]; exists {
+		t.Error("the least recently seen client was kept")
+	}
+	if l.Allow(fmt.Sprint("client", maxBuckets+9)) {
+		t.Error("the most recent client's bucket was forgotten")
+	}
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := NewRateLimiter(1, 1, trusted)
+
+	tests := []struct {
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{remote: "198.51.100.1:1234", want: "198.51.100.1"},
+		{remote: "198.51.100.1:1234", forwarded: "203.0.113.5", want: "198.51.100.1"},
+		{remote: "10.1.2.3:1234", forwarded: "203.0.113.5", want: "203.0.113.5"},
+		{remote: "192.0.2.10:1234", forwarded: "203.0.113.7, 203.0.113.5, 10.0.0.1", want: "203.0.113.5"},
+		{remote: "10.1.2.3:1234", forwarded: "garbage", want: "10.1.2.3"},
+	}
+	for _, tc := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		if got := l.clientIP(r); got != tc.want {
+			t.Errorf("%s forwarding %q: client %s, want %s", tc.remote, tc.forwarded, got, tc.want)
+		}
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/8, nonsense"); err == nil {
+		t.Error("an invalid trusted proxy was accepted")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// Scope holds the previous result, the assigned variables and the memory
+// register, safe for concurrent use by request handlers
+type Scope struct {
+	mu      sync.Mutex
+	ans     float64
+	hasAns  bool
+	vars    map[string]float64
+	maxVars int
+	memory  float64
+}
+
+// NewScope returns a scope with no previous result or variables
+func NewScope() *Scope {
+	return &Scope{vars: make(map[string]float64)}
+}
+
+// NewLimitedScope returns an empty scope holding up to maxVars variables
+func NewLimitedScope(maxVars int) *Scope {
+	return &Scope{vars: make(map[string]float64), maxVars: maxVars}
+}
+
+// Store records a result as ans, and binds the variables it assigned if
+// any, for later expressions. A result assigning more variables than the
+// scope's limit allows isn't stored; a scope without a limit always stores.
+func (s *Scope) Store(result calc.Result) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxVars > 0 {
+		added := make(map[string]bool)
+		for name := range result.Vars {
+			added[name] = true
+		}
+		if result.Assigned != "" {
+			added[result.Assigned] = true
+		}
+		for name := range s.vars {
+			delete(added, name)
+		}
+		if len(s.vars)+len(added) > s.maxVars {
+			return fmt.Errorf("too many variables, the limit is %d", s.maxVars)
+		}
+	}
+
+	s.ans = result.Value
+	s.hasAns = true
+	if result.Assigned != "" {
+		s.vars[result.Assigned] = result.Value
+	}
+	for name, val := range result.Vars {
+		s.vars[name] = val
+	}
+	return nil
+}
+
+// Reset forgets the previous result and every variable, and clears the memory
+func (s *Scope) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ans = 0
+	s.hasAns = false
+	clear(s.vars)
+	s.memory = 0
+}
+
+// AddToMemory adds sign times the previous result to the memory, so 1 for
+// M+ and -1 for M-. It reports false if there is no previous result.
+func (s *Scope) AddToMemory(sign float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.hasAns {
+		return false
+	}
+	s.memory += sign * s.ans
+	return true
+}
+
+// ClearMemory sets the memory back to zero
+func (s *Scope) ClearMemory() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.memory = 0
+}
+
+// Memory returns the value in the memory
+func (s *Scope) Memory() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.memory
+}
+
+// Vars returns a copy of the variables with the memory bound as MR, and
+// ans bound once there is a previous result
+func (s *Scope) Vars() map[string]float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vars := maps.Clone(s.vars)
+	vars[calc.Memory] = s.memory
+	if s.hasAns {
+		vars[calc.Ans] = s.ans
+	}
+	return vars
+}
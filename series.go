@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// maxSeriesPoints is the most points returned by one /api/series request
+const maxSeriesPoints = 1000
+
+// seriesVariable is the free variable stepped over the range
+const seriesVariable = "x"
+
+// SeriesPoint is the value of the expression at one x. Points where the
+// expression can't be evaluated, eg. 1/x at 0, are invalid with an error.
+type SeriesPoint struct {
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	Valid bool    `json:"valid"`
+	Error string  `json:"error,omitempty"`
+}
+
+// SeriesResponse is the JSON body returned by /api/series
+type SeriesResponse struct {
+	Points []SeriesPoint `json:"points"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// apiSeriesHandler evaluates the expr parameter for x from the from
+// parameter to the to parameter in increments of step, for plotting
+func apiSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSON(w, http.StatusMethodNotAllowed, SeriesResponse{Error: "method not allowed, use GET"})
+		return
+	}
+
+	query := r.URL.Query()
+	opts := baseOptions()
+	if err := parseSettings(&opts, query); err != nil {
+		writeJSON(w, http.StatusBadRequest, SeriesResponse{Error: err.Error()})
+		return
+	}
+
+	xs, err := parseSeriesRange(query)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, SeriesResponse{Error: err.Error()})
+		return
+	}
+
+	// Reject malformed expressions once rather than at every point
+	Expr := query.Get("expr")
+	if err := checkLength(Expr); err != nil {
+		writeJSON(w, http.StatusBadRequest, SeriesResponse{Error: err.Error()})
+		return
+	}
+	opts.Vars = map[string]float64{seriesVariable: xs[0]}
+	if _, _, err := parseTree(Expr, opts); err != nil {
+		writeJSON(w, http.StatusBadRequest, SeriesResponse{Error: err.Error()})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), *evalTimeout)
+	defer cancel()
+
+	points := make([]SeriesPoint, len(xs))
+	for i, x := range xs {
+		points[i].X = x
+
+		opts.Vars = map[string]float64{seriesVariable: x}
+		result, err := calc.CalculateContext(ctx, Expr, opts)
+		if errors.Is(err, calc.ErrTimeout) {
+			writeJSON(w, http.StatusServiceUnavailable, SeriesResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			points[i].Error = err.Error()
+			continue
+		}
+		points[i].Y = result.Value
+		points[i].Valid = true
+	}
+
+	writeJSON(w, http.StatusOK, SeriesResponse{Points: points})
+}
+
+// parseSeriesRange returns the x values from the from, to and step
+// parameters. Each is computed from the start rather than by repeated
+// addition, so steps such as 0.1 don't accumulate rounding errors.
+func parseSeriesRange(query url.Values) ([]float64, error) {
+	bounds := make(map[string]float64, 3)
+	for _, name := range []string{"from", "to", "step"} {
+		val, err := strconv.ParseFloat(query.Get(name), 64)
+		if err != nil || math.IsInf(val, 0) || math.IsNaN(val) {
+			return nil, fmt.Errorf("%s must be a finite number", name)
+		}
+		bounds[name] = val
+	}
+
+	from, to, step := bounds["from"], bounds["to"], bounds["step"]
+	switch {
+	case step <= 0:
+		return nil, errors.New("step must be positive")
+	case to < from:
+		return nil, errors.New("to must not be less than from")
+	}
+
+	// Allow for rounding in the division, so 0 to 1 step 0.1 includes 1
+	count := math.Floor((to-from)/step+1e-9) + 1
+	if count > maxSeriesPoints {
+		return nil, fmt.Errorf("too many points, the limit is %d", maxSeriesPoints)
+	}
+
+	xs := make([]float64, int(count))
+	for i := range xs {
+		xs[i] = from + float64(i)*step
+	}
+	return xs, nil
+}
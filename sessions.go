@@ -0,0 +1,110 @@
+package main
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionCookie names the cookie identifying a browser's session
+	sessionCookie = "session"
+	// maxSessions bounds the number of sessions kept at once
+	maxSessions = 10000
+	// sessionIdleTimeout is how long an unused session is kept
+	sessionIdleTimeout = 30 * time.Minute
+	// maxSessionVars bounds the number of variables a session can assign
+	maxSessionVars = 100
+)
+
+// Sessions keeps a scope for each browser, identified by a session cookie,
+// so users of the web form don't see each other's ans, variables and
+// memory. Sessions idle for longer than a timeout are forgotten, as are the
+// least recently used ones beyond a number of sessions. It is safe for
+// concurrent use.
+type Sessions struct {
+	mu      sync.Mutex
+	size    int
+	idle    time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+	now     func() time.Time
+}
+
+// session is one browser's scope and when it was last used
+type session struct {
+	id       string
+	scope    *Scope
+	lastUsed time.Time
+}
+
+// NewSessions returns an empty store holding up to size sessions, each
+// until it has been idle for idle
+func NewSessions(size int, idle time.Duration) *Sessions {
+	return &Sessions{
+		size:    size,
+		idle:    idle,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Scope returns the scope of the request's session. A request without a
+// known session cookie starts a new session, whose cookie is set on w.
+func (s *Sessions) Scope(w http.ResponseWriter, r *http.Request) *Scope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		if elem, ok := s.entries[cookie.Value]; ok {
+			entry := elem.Value.(*session)
+			entry.lastUsed = s.now()
+			s.order.MoveToBack(elem)
+			return entry.scope
+		}
+	}
+
+	entry := &session{id: newSessionID(), scope: NewLimitedScope(maxSessionVars), lastUsed: s.now()}
+	for s.order.Len() > 0 && s.order.Len() >= s.size {
+		s.remove(s.order.Front())
+	}
+	s.entries[entry.id] = s.order.PushBack(entry)
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    entry.id,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return entry.scope
+}
+
+// expire forgets the sessions idle for too long. Using a session moves it
+// to the back, so they are ordered by when they were last used.
+func (s *Sessions) expire() {
+	now := s.now()
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		if now.Sub(elem.Value.(*session).lastUsed) < s.idle {
+			return
+		}
+		s.remove(elem)
+	}
+}
+
+// remove forgets a session
+func (s *Sessions) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*session).id)
+}
+
+// newSessionID returns a random 32 hex digit ID, too long to guess
+func newSessionID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GoCalculate/GoCalculate/calc"
+)
+
+// postSession submits the form with the session cookie if there is one,
+// and returns the response and the session cookie to send next
+func postSession(c *Calculator, session *http.Cookie, expr string) (*httptest.ResponseRecorder, *http.Cookie) {
+	values := url.Values{"arithmetic_equation": {expr}}
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if session != nil {
+		r.AddCookie(session)
+	}
+	w := httptest.NewRecorder()
+	c.calculatorHandler(w, r)
+	if cookie := responseSession(w); cookie != nil {
+		session = cookie
+	}
+	return w, session
+}
+
+// responseSession returns the session cookie the response sets, or nil
+func responseSession(w *httptest.ResponseRecorder) *http.Cookie {
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func TestSessionVariables(t *testing.T) {
+	c := newTestCalculator()
+	_, alice := postSession(c, nil, "x = 5")
+	_, bob := postSession(c, nil, "x = 7")
+	if alice == nil || bob == nil || alice.Value == bob.Value {
+		t.Fatalf("sessions %v and %v, want two different cookies", alice, bob)
+	}
+
+	tests := []struct {
+		session *http.Cookie
+		expr    string
+		want    string
+	}{
+		{session: alice, expr: "x * 2", want: "Result: 10"},
+		{session: bob, expr: "x * 2", want: "Result: 14"},
+		{session: nil, expr: "x * 2", want: "unknown name: x"},
+	}
+	for _, tc := range tests {
+		w, _ := postSession(c, tc.session, tc.expr)
+		if !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s in session %v: page has no %q", tc.expr, tc.session, tc.want)
+		}
+	}
+}
+
+func TestSessionAns(t *testing.T) {
+	c := newTestCalculator()
+	_, alice := postSession(c, nil, "2 + 3")
+	_, bob := postSession(c, nil, "10 * 10")
+
+	tests := []struct {
+		session *http.Cookie
+		expr    string
+		want    string
+	}{
+		{session: alice, expr: "ans * 2", want: "Result: 10"},
+		{session: bob, expr: "ans + 1", want: "Result: 101"},
+		{session: alice, expr: "ans + 1", want: "Result: 11"},
+		{session: bob, expr: "ans * 3", want: "Result: 303"},
+		{session: nil, expr: "ans", want: calc.ErrNoPreviousResult.Error()},
+	}
+	for _, tc := range tests {
+		w, _ := postSession(c, tc.session, tc.expr)
+		if !strings.Contains(w.Body.String(), tc.want) {
+			t.Errorf("%s in session %v: page has no %q", tc.expr, tc.session, tc.want)
+		}
+	}
+}
+
+func TestSessionVariableLimit(t *testing.T) {
+	scope := NewLimitedScope(2)
+	for _, name := range []string{"x", "y", "x"} {
+		if err := scope.Store(calc.Result{Value: 1, Assigned: name}); err != nil {
+			t.Fatalf("assigning %s: %v", name, err)
+		}
+	}
+
+	err := scope.Store(calc.Result{Value: 2, Vars: map[string]float64{"y": 2, "z": 2}})
+	if want := "too many variables, the limit is 2"; err == nil || err.Error() != want {
+		t.Errorf("assigning a third variable: error %v, want %q", err, want)
+	}
+	if vars := scope.Vars(); vars["y"] != 1 || vars[calc.Ans] != 1 {
+		t.Errorf("a rejected result was stored, the variables are %v", vars)
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	s := NewSessions(10, time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	visit := func(session *http.Cookie) (*Scope, *http.Cookie) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if session != nil {
+			r.AddCookie(session)
+		}
+		w := httptest.NewRecorder()
+		return s.Scope(w, r), responseSession(w)
+	}
+
+	scope, session := visit(nil)
+	if session == nil {
+		t.Fatal("a new session set no cookie")
+	}
+
+	// Each use keeps the session for another idle timeout
+	for range 3 {
+		now = now.Add(45 * time.Second)
+		if again, cookie := visit(session); again != scope || cookie != nil {
+			t.Fatalf("after %v idle: a new session %v", 45*time.Second, cookie)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+	if again, cookie := visit(session); again == scope || cookie == nil || cookie.Value == session.Value {
+		t.Errorf("after the idle timeout: the expired session was kept")
+	}
+}
+
+func TestSessionEviction(t *testing.T) {
+	s := NewSessions(2, time.Hour)
+	var sessions []*http.Cookie
+	for range 3 {
+		w := httptest.NewRecorder()
+		s.Scope(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		sessions = append(sessions, responseSession(w))
+	}
+
+	// Check the newest first, as restarting a session evicts another
+	for i := len(sessions) - 1; i >= 0; i-- {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(sessions[i])
+		w := httptest.NewRecorder()
+		s.Scope(w, r)
+		if restarted := responseSession(w) != nil; restarted != (i == 0) {
+			t.Errorf("session %d restarted %v, want only the oldest restarted", i, restarted)
+		}
+	}
+}